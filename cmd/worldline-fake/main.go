@@ -0,0 +1,20 @@
+// Command worldline-fake runs a fake worldline/bambora checkout for local
+// development. Point the worldline APIURL in config.json at
+// http://localhost:8081/sessions and use the same md5 key.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"upforschool/internal/pkg/worldline"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "listen address")
+	md5key := flag.String("md5key", "", "md5 key used to sign callbacks")
+	flag.Parse()
+
+	log.Println("worldline fake listening on", *addr)
+	log.Fatal(http.ListenAndServe(*addr, worldline.NewFakeServer(*md5key)))
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 	"upforschool/internal/bankid"
 	"upforschool/internal/database"
@@ -25,6 +26,13 @@ func cookie(c *Config) *securecookie.SecureCookie {
 
 type mailer interface {
 	SendActivationEmail(name, toEmail, tokenID, tokenValue string)
+	SendSubscriptionReminder(name, toEmail, planName string, endsAt time.Time)
+	SendRefundNotice(name, toEmail, title, amount string)
+	SendReceipt(name, toEmail, number string, receipt []byte)
+	SendLessonRescheduled(name, toEmail, title, startAt string, duration int)
+	SendLessonDeclined(name, toEmail, title string)
+	SendLessonExpired(name, toEmail, title string, tutors []string)
+	SendNewMessage(name, toEmail, from, title, path string)
 }
 
 // App structure.
@@ -84,6 +92,7 @@ func (a *App) routes() {
 	a.router.HandleFunc("/profiles/image", a.handleAuth(a.handleProfileImage()))
 	a.router.HandleFunc("/profiles/password", a.handleAuth(a.handleProfilePassword()))
 	a.router.HandleFunc("/profiles/email", a.handleAuth(a.handleProfileEmail()))
+	r.HandleFunc("GET /profile/receipts/{number}", a.handleAuth(a.handleReceipt))
 
 	r.HandleFunc("/lesson/new", a.handleAuth(a.handleNewLesson))
 	r.HandleFunc("/lesson/edit", a.handleAuth(a.handleLessonEdit))
@@ -91,9 +100,59 @@ func (a *App) routes() {
 	r.HandleFunc("GET /tutors/list", a.handleAuth(a.handleGetTutors))
 	r.HandleFunc("GET /lessons/list", a.handleAuth(a.handleListLessons))
 	r.HandleFunc("GET /lesson/accept", a.handleAuth(a.handleLessonAccept))
+	r.HandleFunc("POST /lesson/decline", a.handleAuth(a.handleLessonDecline))
 	r.HandleFunc("GET /lesson/delete", a.handleAuth(a.handleLessonDelete))
+	r.HandleFunc("POST /lesson/complete", a.handleAuth(a.handleLessonComplete))
+	r.HandleFunc("POST /lesson/no-show", a.handleAuth(a.handleLessonNoShow))
+	r.HandleFunc("POST /lesson/tutor-cancel", a.handleAuth(a.handleLessonTutorCancel))
+	r.HandleFunc("POST /lesson/series/accept", a.handleAuth(a.handleSeriesAccept))
+	r.HandleFunc("POST /lesson/series/cancel", a.handleAuth(a.handleSeriesCancel))
+	r.HandleFunc("GET /lesson/ics", a.handleAuth(a.handleLessonICS))
+	r.HandleFunc("POST /lesson/choose", a.handleAuth(a.handleChooseApplicant))
+
+	r.HandleFunc("GET /board", a.handleAuth(a.handleBoard))
+	r.HandleFunc("POST /board/apply", a.handleAuth(a.handleBoardApply))
+
+	r.HandleFunc("GET /calendar/{token}", a.handleCalendarFeed) // {token}.ics
+	r.HandleFunc("POST /calendar/reset", a.handleAuth(a.handleCalendarReset))
+
+	r.HandleFunc("GET /earnings", a.handleAuth(a.handleEarnings))
+	r.HandleFunc("GET /earnings/statement", a.handleAuth(a.handleEarningsStatement))
+
+	r.HandleFunc("GET /availability", a.handleAuth(a.handleAvailability))
+	r.HandleFunc("POST /availability/weekly", a.handleAuth(a.handleAddAvailability))
+	r.HandleFunc("POST /availability/weekly/delete", a.handleAuth(a.handleDeleteAvailability))
+	r.HandleFunc("POST /availability/exceptions", a.handleAuth(a.handleAddAvailabilityException))
+	r.HandleFunc("POST /availability/exceptions/delete", a.handleAuth(a.handleDeleteAvailabilityException))
 
 	r.HandleFunc("GET /tutor/summary", a.handleAuth(a.handleGetTutorSummary))
+	r.HandleFunc("GET /tutors", a.handleTutors)
+	r.HandleFunc("GET /tutors/{alias}", a.handleTutorProfile)
+	r.HandleFunc("GET /search", a.handleSearch)
+
+	r.HandleFunc("GET /messages", a.handleAuth(a.handleMessages))
+	r.HandleFunc("POST /messages", a.handleAuth(a.handleSendMessage))
+	r.HandleFunc("GET /messages/unread", a.handleAuth(a.handleUnreadMessages))
+
+	r.HandleFunc("POST /lesson/rate", a.handleAuth(a.handleLessonRate))
+	r.HandleFunc("GET /ratings", a.handleAuth(a.handleRatings))
+	r.HandleFunc("POST /ratings/reply", a.handleAuth(a.handleRatingReply))
+
+	// worldline payments
+	r.HandleFunc("GET /lesson/checkout", a.handleAuth(a.handleLessonCheckout))
+	r.HandleFunc("POST /lesson/checkout/discount", a.handleAuth(a.handleLessonCheckoutDiscount))
+	r.HandleFunc("GET /lesson/checkout/pay", a.handleAuth(a.handleLessonPay))
+	r.HandleFunc("GET /lessons/orders/accept", a.handleAuth(a.handleOrderAccept))
+	r.HandleFunc("GET /lessons/orders/cancel", a.handleAuth(a.handleOrderCancel))
+	r.HandleFunc("GET /lessons/orders/callback", a.handleOrderCallback)
+	r.HandleFunc("GET /subscriptions", a.handleAuth(a.handleSubscriptions))
+	r.HandleFunc("POST /subscription/checkout", a.handleAuth(a.handleSubscriptionCheckout))
+	r.HandleFunc("GET /subscriptions/accept", a.handleAuth(a.handleSubscriptionAccept))
+	r.HandleFunc("GET /subscriptions/cancel", a.handleAuth(a.handleSubscriptionCancel))
+	r.HandleFunc("GET /subscriptions/callback", a.handleSubscriptionCallback)
+	r.HandleFunc("POST /admin/orders/refund", a.handleAuth(a.handleOrderRefund))
+	r.HandleFunc("POST /admin/payouts", a.handleAuth(a.handleAddPayout))
+	r.HandleFunc("POST /admin/ratings/hide", a.handleAuth(a.handleRatingHide))
 
 	r.HandleFunc("/home", a.handleAuth(a.homeHandler))
 }
@@ -102,6 +161,25 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.router.ServeHTTP(w, r)
 }
 
+// lessonStatusNames shown for lesson statuses.
+var lessonStatusNames = map[string]string{
+	model.LessonRequested:          "Ej bokad",
+	model.LessonAccepted:           "Accepterad",
+	model.LessonScheduled:          "Bokad",
+	model.LessonCompleted:          "Genomförd",
+	model.LessonCancelledByStudent: "Avbokad av eleven",
+	model.LessonCancelledByTutor:   "Avbokad av studiecoachen",
+	model.LessonNoShow:             "Eleven kom inte",
+}
+
+// declineReasonNames shown when a tutor declines a lesson request.
+var declineReasonNames = map[string]string{
+	model.DeclineReasonBusy:     "Har inte tid",
+	model.DeclineReasonSubject:  "Inte mitt ämne eller nivå",
+	model.DeclineReasonLocation: "För långt bort",
+	model.DeclineReasonOther:    "Annat",
+}
+
 // New creates app for config.
 func New(c *Config) (*App, error) {
 	db, err := database.New(c.DB)
@@ -123,6 +201,8 @@ func New(c *Config) (*App, error) {
 	}
 
 	wl := worldline.New(
+		c.Worldline.APIURL,
+		c.Worldline.TransactionURL,
 		c.App.URL,
 		c.Worldline.Merchant,
 		c.Worldline.Username,
@@ -167,6 +247,21 @@ func New(c *Config) (*App, error) {
 			result, _ := json.Marshal(item)
 			return string(result)
 		},
+		"money": func(amount int64, currency string) string {
+			return model.Money{Amount: amount, Currency: currency}.String()
+		},
+		"datetime": func(t time.Time) string {
+			return t.In(model.Timezone).Format("2006-01-02 15:04")
+		},
+		"highlight": func(snippet string) template.HTML {
+			s := template.HTMLEscapeString(snippet)
+			s = strings.ReplaceAll(s, model.SnippetStart, "<mark>")
+			s = strings.ReplaceAll(s, model.SnippetStop, "</mark>")
+			return template.HTML(s)
+		},
+		"lessonStatus": func(status string) string {
+			return lessonStatusNames[status]
+		},
 		"multiply": func(a int64, b int) int64 {
 			return a * int64(b)
 		},
@@ -223,5 +318,9 @@ func New(c *Config) (*App, error) {
 }
 
 func (a *App) Run() {
+	go a.runSubscriptionReminders(time.Hour)
+	go a.runUnacceptedRefunds(time.Hour)
+	go a.runLessonExpiry(time.Hour)
+
 	log.Fatal(http.ListenAndServe(a.config.App.Addr, a.router))
 }
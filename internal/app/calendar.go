@@ -0,0 +1,119 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"upforschool/internal/model"
+	"upforschool/internal/pkg/ical"
+)
+
+// calendarURL of the feed with token, to subscribe to in a calendar app.
+func (a *App) calendarURL(token string) string {
+	return a.config.App.URL + "/calendar/" + token + ".ics"
+}
+
+// calendarEvent of the lesson, named after the subject, level and the other
+// person of the lesson.
+func (a *App) calendarEvent(l model.CalendarLesson) ical.Event {
+	with := l.TutorName
+	if l.AsTutor {
+		with = l.StudentName
+	}
+
+	location := l.LocationName
+	if l.OnlineLesson {
+		location = "Online"
+	}
+
+	description := l.Title
+	if l.Description != "" {
+		description += "\n\n" + l.Description
+	}
+
+	return ical.Event{
+		UID:         l.ID + "@upforschool.se",
+		Summary:     fmt.Sprintf("%s %s med %s", l.SubjectName, l.LevelName, with),
+		Description: description,
+		Location:    location,
+		URL:         a.config.App.URL + "/home",
+		Start:       l.StartAt,
+		End:         l.StartAt.Add(time.Duration(l.Duration) * time.Minute),
+		Modified:    l.UpdatedAt,
+		Sequence:    l.Sequence,
+		Cancelled:   l.DeletedAt.Valid,
+	}
+}
+
+// handleCalendarFeed of the user's lessons by the secret token in the URL,
+// without login so calendar apps can subscribe.
+func (a *App) handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutSuffix(r.PathValue("token"), ".ics")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := a.repo.UserByCalendarToken(token)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("handleCalendarFeed: unable to fetch user:", err)
+		http.Error(w, "unable to fetch calendar", http.StatusInternalServerError)
+		return
+	}
+
+	lessons, err := a.repo.CalendarLessons(user.ID)
+	if err != nil {
+		log.Println("handleCalendarFeed: unable to fetch lessons:", err)
+		http.Error(w, "unable to fetch calendar", http.StatusInternalServerError)
+		return
+	}
+
+	calendar := ical.Calendar{Name: "Up For School"}
+	for _, l := range lessons {
+		calendar.Events = append(calendar.Events, a.calendarEvent(l))
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(calendar.Bytes())
+}
+
+// handleLessonICS downloads a single accepted lesson by lesson_id. The file
+// is built on every download, so it follows reschedules and cancellations.
+func (a *App) handleLessonICS(w http.ResponseWriter, r *http.Request) {
+	lesson, err := a.repo.CalendarLesson(a.profile(r).User.ID, r.URL.Query().Get("lesson_id"))
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonICS: unable to fetch lesson:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
+	calendar := ical.Calendar{Events: []ical.Event{a.calendarEvent(*lesson)}}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=lektion-%s.ics", lesson.StartAt.In(model.Timezone).Format("2006-01-02")))
+	w.Write(calendar.Bytes())
+}
+
+// handleCalendarReset gives the user a new calendar feed URL, for when the
+// old one has been shared.
+func (a *App) handleCalendarReset(w http.ResponseWriter, r *http.Request) {
+	if err := a.core.ResetCalendarToken(a.profile(r).User.ID); err != nil {
+		log.Println("handleCalendarReset: unable to reset calendar token:", err)
+		http.Error(w, "unable to reset calendar", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
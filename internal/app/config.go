@@ -35,13 +35,22 @@ type Config struct {
 		Region          string `json:"region"`
 	} `json:"email"`
 	Worldline struct {
-		Merchant string
-		Username string
-		Password string
-		MD5key   string
+		APIURL         string
+		TransactionURL string
+		Merchant       string
+		Username       string
+		Password       string
+		MD5key         string
 	} `json:"worldline"`
 	DB *database.Config `json:"db"`
 
+	// Lessons are expired and archived in the background, days are
+	// defaulted in jobs.go when not set.
+	Lessons struct {
+		RequestExpiryDays int `json:"requestExpiryDays"`
+		ArchiveAfterDays  int `json:"archiveAfterDays"`
+	} `json:"lessons"`
+
 	PostmarkToken string `json:"postmarkToken"`
 }
 
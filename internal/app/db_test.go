@@ -0,0 +1,243 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"upforschool/internal/model"
+	"upforschool/internal/viewer"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// testDBEnv names the postgres data source the handler tests run against, the
+// same database as the model tests. They are skipped without it.
+const testDBEnv = "UPFORSCHOOL_TEST_DB"
+
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDBEnv)
+	if dsn == "" {
+		t.Skip(testDBEnv + " not set")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testPages the handler tests render. Each renders the JSON of its page data,
+// so the tests see what the handlers pass to the real templates.
+var testPages = []string{
+	"board.html",
+	"lessons-list.html",
+	"messages.html",
+	"tutor-selector.html",
+	"tutor-summary-partial.html",
+}
+
+// testApp on the test database.
+func testApp(t *testing.T) (*App, *sqlx.DB) {
+	t.Helper()
+
+	db := testDB(t)
+
+	dir := t.TempDir()
+	files := make([]string, len(testPages))
+	for i, name := range testPages {
+		files[i] = filepath.Join(dir, name)
+		if err := os.WriteFile(files[i], []byte("{{data .Data}}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v := viewer.New(files, nil)
+	v.Funcs(template.FuncMap{
+		"data": func(data map[string]any) (template.HTML, error) {
+			b, err := json.Marshal(data)
+			return template.HTML(b), err
+		},
+	})
+
+	return &App{
+		repo: model.NewRepository(db),
+		core: model.NewCore(db, nil),
+		view: v,
+	}, db
+}
+
+// serve target with handler as the user, with the profile handleAuth adds,
+// and return the response body.
+func serve(t *testing.T, a *App, handler http.HandlerFunc, userID, target string) []byte {
+	t.Helper()
+
+	user, err := a.repo.User(userID)
+	if err != nil {
+		t.Fatalf("fetch user: %v", err)
+	}
+
+	var tutor model.Tutor
+	if tt, err := a.repo.TutorByUserID(userID); err == nil {
+		tutor = *tt
+	}
+
+	ctx := context.WithValue(context.Background(), model.ContextKeyProfile, model.Profile{
+		User:    *user,
+		IsTutor: tutor.ID != "",
+	})
+	ctx = context.WithValue(ctx, model.ContextKeyTutor, tutor)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", target, w.Code, w.Body)
+	}
+	return w.Body.Bytes()
+}
+
+// servePage is serve decoding the page data into data.
+func servePage(t *testing.T, a *App, handler http.HandlerFunc, userID, target string, data any) {
+	t.Helper()
+
+	if err := json.Unmarshal(serve(t, a, handler, userID, target), data); err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+}
+
+func newTestID(t *testing.T) string {
+	t.Helper()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id.String()
+}
+
+// mustExec query or fail the test.
+func mustExec(t *testing.T, db *sqlx.DB, query string, args ...any) {
+	t.Helper()
+
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// seededIDs of the first subject, level and location in migrations.sql.
+func seededIDs(t *testing.T, db *sqlx.DB) (subjectID, levelID, locationID int) {
+	t.Helper()
+
+	query := "SELECT (SELECT MIN(id) FROM subjects), (SELECT MIN(id) FROM levels), (SELECT MIN(id) FROM locations)"
+	if err := db.QueryRow(query).Scan(&subjectID, &levelID, &locationID); err != nil {
+		t.Fatalf("seeded subject, level and location: %v", err)
+	}
+	return subjectID, levelID, locationID
+}
+
+// addTestUser confirmed, with an email and phone to tell apart.
+func addTestUser(t *testing.T, db *sqlx.DB, firstName string) string {
+	t.Helper()
+
+	id := newTestID(t)
+	mustExec(t, db, `
+	INSERT INTO users (id, first_name, last_name, email, phone, password, status)
+	VALUES ($1, $2, 'Test', $3, $4, '', 'CONFIRMED')`,
+		id, firstName, id+"@example.com", "070"+id[:7])
+
+	t.Cleanup(func() {
+		mustExec(t, db, "DELETE FROM users WHERE id = $1", id)
+	})
+	return id
+}
+
+// addTestTutor for the user, acting as tutor, teaching the seeded subject and
+// level online.
+func addTestTutor(t *testing.T, db *sqlx.DB, userID string) string {
+	t.Helper()
+
+	subjectID, levelID, _ := seededIDs(t, db)
+
+	id := newTestID(t)
+	mustExec(t, db, `
+	INSERT INTO tutors (id, user_id, first_name, last_name, alias, image, online_lessons)
+	VALUES ($1, $2, 'Test', 'Test', $3, '', TRUE)`,
+		id, userID, "test-"+id)
+	mustExec(t, db, "INSERT INTO tutor_subjects (tutor_id, subject_id) VALUES ($1, $2)", id, subjectID)
+	mustExec(t, db, "INSERT INTO tutor_levels (tutor_id, level_id) VALUES ($1, $2)", id, levelID)
+	mustExec(t, db, "UPDATE users SET active_role = 'TUTOR' WHERE id = $1", userID)
+
+	t.Cleanup(func() {
+		mustExec(t, db, "DELETE FROM tutor_subjects WHERE tutor_id = $1", id)
+		mustExec(t, db, "DELETE FROM tutor_levels WHERE tutor_id = $1", id)
+		mustExec(t, db, "DELETE FROM tutors WHERE id = $1", id)
+	})
+	return id
+}
+
+// addTestLesson online for the student at startAt, with a single slot. Open
+// lessons are published on the board.
+func addTestLesson(t *testing.T, db *sqlx.DB, studentID string, startAt time.Time, open bool) string {
+	t.Helper()
+
+	subjectID, levelID, locationID := seededIDs(t, db)
+
+	id := newTestID(t)
+	mustExec(t, db, `
+	INSERT INTO lessons (id, student_id, subject_id, level_id, location_id, online_lesson, title, start_at, duration, is_open, published_at)
+	VALUES ($1, $2, $3, $4, $5, TRUE, 'Test', $6, 60, $7, CASE WHEN $7 THEN CURRENT_TIMESTAMP END)`,
+		id, studentID, subjectID, levelID, locationID, startAt, open)
+	mustExec(t, db, `
+	INSERT INTO lesson_slots (lesson_id, start_at, duration, location_id, online_lesson)
+	VALUES ($1, $2, 60, $3, TRUE)`,
+		id, startAt, locationID)
+
+	t.Cleanup(func() {
+		mustExec(t, db, "DELETE FROM lesson_messages WHERE lesson_id = $1", id)
+		mustExec(t, db, "DELETE FROM lesson_status_history WHERE lesson_id = $1", id)
+		mustExec(t, db, "DELETE FROM lesson_requests WHERE lesson_id = $1", id)
+		mustExec(t, db, "DELETE FROM lesson_slots WHERE lesson_id = $1", id)
+		mustExec(t, db, "DELETE FROM lessons WHERE id = $1", id)
+	})
+	return id
+}
+
+// addTestRequest of the lesson to the tutor with status.
+func addTestRequest(t *testing.T, db *sqlx.DB, lessonID, tutorID, status string) {
+	t.Helper()
+
+	mustExec(t, db, `
+	INSERT INTO lesson_requests (lesson_id, tutor_id, status)
+	VALUES ($1, $2, $3)`,
+		lessonID, tutorID, status)
+}
+
+// setTestLessonTutor as if tutorID accepted the lesson, with the lesson in
+// status.
+func setTestLessonTutor(t *testing.T, db *sqlx.DB, lessonID, tutorID, status string) {
+	t.Helper()
+
+	mustExec(t, db, "UPDATE lessons SET tutor_id = $2, status = $3 WHERE id = $1", lessonID, tutorID, status)
+	mustExec(t, db, "UPDATE lesson_requests SET status = 'ACCEPTED' WHERE lesson_id = $1 AND tutor_id = $2", lessonID, tutorID)
+}
+
+// testContact of the user.
+func testContact(t *testing.T, db *sqlx.DB, userID string) (email, phone string) {
+	t.Helper()
+
+	if err := db.QueryRow("SELECT email, phone FROM users WHERE id = $1", userID).Scan(&email, &phone); err != nil {
+		t.Fatal(err)
+	}
+	return email, phone
+}
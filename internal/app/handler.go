@@ -151,6 +151,17 @@ func (a *App) activeTutor(r *http.Request) bool {
 	return a.profile(r).User.ActiveRole == string(model.ActiveRoleTutor)
 }
 
+// hideTutorContacts clears the email and phone of the tutors not in
+// contacts, the ones the student has no accepted lesson with. Until then they
+// talk through lesson messages.
+func hideTutorContacts(contacts map[string]bool, tutors []model.TutorView) {
+	for i := range tutors {
+		if !contacts[tutors[i].ID] {
+			tutors[i].HideContact()
+		}
+	}
+}
+
 func (a *App) page(name string) http.HandlerFunc {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -164,13 +175,20 @@ func (a *App) page(name string) http.HandlerFunc {
 
 func (a *App) homeHandler(w http.ResponseWriter, r *http.Request) {
 
-	LessonRequests, err := a.repo.SentLessonRequests(a.profile(r).User.ID)
+	LessonRequests, err := a.repo.SentLessonRequests(a.profile(r).User.ID, false)
 	if err != nil {
 		log.Println("failed to get lesson requests:", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	threads, err := a.repo.MessageThreads(a.profile(r).User.ID)
+	if err != nil {
+		log.Println("failed to get message threads:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	var page *viewer.Page
 	if a.activeTutor(r) {
 		page = a.view.Page("home-tutor.html")
@@ -179,7 +197,8 @@ func (a *App) homeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	page.Add("Profile", a.profile(r)).
-		Add("LessonRequests", LessonRequests)
+		Add("LessonRequests", LessonRequests).
+		Add("Threads", threads)
 
 	if err := a.view.Execute(w, page); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -488,6 +507,12 @@ func (a *App) handleSignupTutor() http.HandlerFunc {
 				http.Error(w, "invalid BankID token", http.StatusForbidden)
 				return
 			}
+
+			// checked before the user is added, AddTutor would fail after it.
+			if model.ReservedAlias(alias) {
+				http.Redirect(w, r, "/signup?error=alias", http.StatusFound)
+				return
+			}
 			firstname := claim.GivenName
 			lastname := claim.Surname
 			year, _ := strconv.Atoi(claim.SSN[:4])
@@ -651,11 +676,31 @@ func (a *App) handleProfile(w http.ResponseWriter, r *http.Request) {
 
 	a.repo.TutorByUserID(profile.User.ID)
 
+	subscription, err := a.repo.ActiveSubscription(profile.User.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("handleProfile: unable to fetch subscription:", err)
+	}
+
+	receipts, err := a.repo.Receipts(profile.User.ID)
+	if err != nil {
+		log.Println("handleProfile: unable to fetch receipts:", err)
+	}
+
+	var calendarURL string
+	if token, err := a.core.CalendarToken(profile.User.ID); err != nil {
+		log.Println("handleProfile: unable to fetch calendar token:", err)
+	} else {
+		calendarURL = a.calendarURL(token)
+	}
+
 	page := a.view.
 		Page("profile.html").
 		Add("ActiveRole", profile.User.ActiveRole).
 		Add("Profile", profile).
-		Add("Tutor", tutor)
+		Add("Tutor", tutor).
+		Add("Subscription", subscription).
+		Add("Receipts", receipts).
+		Add("CalendarURL", calendarURL)
 
 	if err := a.view.Execute(w, page); err != nil {
 		log.Printf("handleConfirm: %v", err)
@@ -690,6 +735,18 @@ func (a *App) handleNewLesson(w http.ResponseWriter, r *http.Request) {
 			Add("Levels", levels).
 			Add("Locations", locations)
 
+		// prefilled from a tutor's profile
+		if tutorID := r.URL.Query().Get("tutor_id"); tutorID != "" {
+			tutor, err := a.repo.Tutor(tutorID)
+			if err != nil {
+				log.Println("handleNewLesson: unable to fetch tutor:", err)
+			} else {
+				page.Add("TutorID", tutor.ID).Add("TutorAlias", tutor.Alias)
+			}
+		}
+		subjectID, _ := strconv.Atoi(r.URL.Query().Get("subject_id"))
+		page.Add("SubjectID", subjectID)
+
 		if err := a.view.Execute(w, page); err != nil {
 			log.Printf("handleConfirm: %v", err)
 		}
@@ -704,16 +761,33 @@ func (a *App) handleNewLesson(w http.ResponseWriter, r *http.Request) {
 		}
 
 		lessonID, err := a.core.AddLesson(a.profile(r).User.ID, req)
+		if errors.Is(err, model.ErrLessonStartInPast) || errors.Is(err, model.ErrLessonDuration) ||
+			errors.Is(err, model.ErrLessonSlots) || errors.Is(err, model.ErrRecurrence) || errors.Is(err, model.ErrSeriesSlots) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			log.Println("handleNewLesson: unable to add lesson:", err)
 			http.Error(w, "unable to add lesson", http.StatusInternalServerError)
 			return
 		}
 
+		lesson, err := a.repo.GetLesson(lessonID)
+		if err != nil {
+			log.Println("handleNewLesson: unable to fetch lesson:", err)
+			http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+			return
+		}
+
+		status := "ok"
+		if lesson.AwaitingPayment {
+			status = "awaiting_payment"
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{
 			"lessonID": lessonID,
-			"status":   "ok",
+			"status":   status,
 		})
 
 	default:
@@ -779,13 +853,25 @@ func (a *App) handleLessonEdit(w http.ResponseWriter, r *http.Request) {
 		}
 
 		log.Println("tutors", req.Tutors)
-		err := a.core.UpdateLesson(lessonID, req)
+		rescheduled, err := a.core.UpdateLesson(lessonID, req)
+		if errors.Is(err, model.ErrLessonStartInPast) || errors.Is(err, model.ErrLessonDuration) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, model.ErrTutorBusy) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		if err != nil {
 			log.Println("handleLessonEdit: unable to update lesson:", err)
 			http.Error(w, "unable to update lesson", http.StatusInternalServerError)
 			return
 		}
 
+		if rescheduled {
+			a.notifyRescheduled(lessonID)
+		}
+
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{
 			"lessonID": lessonID,
@@ -797,6 +883,30 @@ func (a *App) handleLessonEdit(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// notifyRescheduled emails the tutors who have the lesson request, or have
+// accepted it, the new time.
+func (a *App) notifyRescheduled(lessonID string) {
+	lesson, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("notifyRescheduled: unable to fetch lesson:", err)
+		return
+	}
+
+	tutors, err := a.repo.LessonTutors(lessonID)
+	if err != nil {
+		log.Println("notifyRescheduled: unable to fetch tutors:", err)
+		return
+	}
+
+	startAt := lesson.StartAt.In(model.Timezone).Format("2006-01-02 15:04")
+	for _, t := range tutors {
+		if t.BookedStatus != model.LessonRequestPending && t.BookedStatus != model.LessonRequestAccepted {
+			continue
+		}
+		a.email.SendLessonRescheduled(t.FirstName, t.Email, lesson.Title, startAt, lesson.Duration)
+	}
+}
+
 func (a *App) handleGetTutors(w http.ResponseWriter, r *http.Request) {
 	subjectID := r.URL.Query().Get("subject")
 	levelID := r.URL.Query().Get("level")
@@ -808,12 +918,39 @@ func (a *App) handleGetTutors(w http.ResponseWriter, r *http.Request) {
 	levelIDInt, _ := strconv.Atoi(levelID)
 	locationIDInt, _ := strconv.Atoi(locationID)
 
-	tutors, err := a.repo.Tutors(onlineLessonsBool, int(locationIDInt), int(subjectIDInt), int(levelIDInt))
+	// the proposed times, from the new lesson form or the lesson being edited.
+	var periods []model.Period
+	if slots := r.URL.Query().Get("slots"); slots != "" {
+		if err := json.Unmarshal([]byte(slots), &periods); err != nil {
+			http.Error(w, "invalid slots", http.StatusBadRequest)
+			return
+		}
+	} else if lessonID != "" {
+		slots, err := a.repo.LessonSlots(lessonID)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "Unable to fetch lesson slots", http.StatusInternalServerError)
+			return
+		}
+		for _, s := range slots {
+			periods = append(periods, model.Period{Start: s.StartAt, Duration: s.Duration})
+		}
+	}
+
+	tutors, err := a.repo.Tutors(onlineLessonsBool, int(locationIDInt), int(subjectIDInt), int(levelIDInt), periods)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Unable to fetch tutors", http.StatusInternalServerError)
+		return
+	}
+
+	contacts, err := a.repo.ContactTutors(a.profile(r).User.ID)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Unable to fetch tutors", http.StatusInternalServerError)
 		return
 	}
+	hideTutorContacts(contacts, tutors)
 
 	if lessonID != "" {
 		// Filter tutors who have already accepted the lesson
@@ -847,39 +984,52 @@ func (a *App) handleGetTutors(w http.ResponseWriter, r *http.Request) {
 
 func (a *App) handleListLessons(w http.ResponseWriter, r *http.Request) {
 
+	// archived lessons are hidden unless "lessons=all" is set.
+	showAllLessons := r.URL.Query().Get("lessons") == "all"
+
 	var err error
 	var lessonRequests []model.LessonView
 	if a.activeTutor(r) {
-		lessonRequests, err = a.repo.ReceivedLessonRequests(a.tutor(r).ID)
+		lessonRequests, err = a.repo.ReceivedLessonRequests(a.tutor(r).ID, showAllLessons)
 		if err != nil {
 			log.Println("failed to get lesson requests:", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	} else {
-		lessonRequests, err = a.repo.SentLessonRequests(a.profile(r).User.ID)
+		lessonRequests, err = a.repo.SentLessonRequests(a.profile(r).User.ID, showAllLessons)
 		if err != nil {
 			log.Println("failed to get lesson requests:", err)
 		}
 	}
 
-	// Remove deleted lessons unless "lessons=all" is set
-	// also remove old accepted lessons
-	showAllLessons := r.URL.Query().Get("lessons") == "all"
-	if !showAllLessons {
-		filteredLessons := []model.LessonView{}
-		for _, lr := range lessonRequests {
-			if lr.DeletedAt.Valid ||
-				lr.AcceptedAt.Valid && lr.AcceptedAt.Time.Add(7*24*time.Hour).Before(time.Now()) { // accepted more than 7 days ago
-				continue
-			}
-			filteredLessons = append(filteredLessons, lr)
+	for i := range lessonRequests {
+		slots, err := a.repo.LessonSlots(lessonRequests[i].ID)
+		if err != nil {
+			log.Println("failed to get lesson slots:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		lessonRequests = filteredLessons
+		lessonRequests[i].Slots = slots
+
+		history, err := a.repo.LessonStatusHistory(lessonRequests[i].ID)
+		if err != nil {
+			log.Println("failed to get lesson history:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		lessonRequests[i].History = history
 	}
 
 	// For student who sent only, fetch the tutors for each lesson
 	if !a.activeTutor(r) {
+		contacts, err := a.repo.ContactTutors(a.profile(r).User.ID)
+		if err != nil {
+			log.Println("failed to get tutor contacts:", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		for i := range lessonRequests {
 			tutors, err := a.repo.LessonTutors(lessonRequests[i].ID)
 			if err != nil {
@@ -887,15 +1037,23 @@ func (a *App) handleListLessons(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			hideTutorContacts(contacts, tutors)
 			lessonRequests[i].Tutors = tutors
 		}
 	}
 
+	var tutorID string
+	if a.activeTutor(r) {
+		tutorID = a.tutor(r).ID
+	}
+
 	page := a.view.
 		Page("lessons-list.html").
 		Add("IsTutor", a.activeTutor(r)).
+		Add("TutorID", tutorID).
 		Add("Lessons", lessonRequests).
 		Add("ShowAllLessons", showAllLessons).
+		Add("DeclineReasons", declineReasonNames).
 		Add("Format", r.URL.Query().Get("format"))
 
 	if err := a.view.Execute(w, page); err != nil {
@@ -918,18 +1076,40 @@ func (a *App) handleLessonAccept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	slotID, err := strconv.ParseInt(r.URL.Query().Get("slot_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid slot_id", http.StatusBadRequest)
+		return
+	}
+
+	slot, err := a.repo.LessonSlot(slotID)
+	if err == sql.ErrNoRows || err == nil && slot.LessonID != lessonID {
+		http.Error(w, model.ErrSlotUnavailable.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonAccept: unable to fetch lesson slot:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
 	tutor := a.tutor(r)
 	log.Println("rs", tutor.OnlineLessons)
 	log.Println(
-		l.OnlineLesson, l.LocationID, l.SubjectID, l.LevelID,
+		slot.OnlineLesson, slot.LocationID, l.SubjectID, l.LevelID,
 	)
 
-	if !tutor.MeetsRequirements(l.OnlineLesson, l.LocationID, l.SubjectID, l.LevelID) {
+	if !tutor.MeetsRequirements(slot.OnlineLesson, slot.LocationID, l.SubjectID, l.LevelID) {
 		http.Error(w, "tutor does not meet lesson requirements", http.StatusForbidden)
 		return
 	}
 
-	_, err = a.core.AcceptLesson(lessonID, tutor.ID)
+	_, err = a.core.AcceptLesson(lessonID, tutor.ID, slot.ID)
+	if errors.Is(err, model.ErrLessonTaken) || errors.Is(err, model.ErrSlotUnavailable) || errors.Is(err, model.ErrTutorBusy) ||
+		errors.Is(err, model.ErrRequestNotPending) || errors.Is(err, model.ErrLessonTransition) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Println("handleLessonAccept: unable to accept lesson:", err)
 		http.Error(w, "unable to accept lesson", http.StatusInternalServerError)
@@ -940,6 +1120,61 @@ func (a *App) handleLessonAccept(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/home", http.StatusSeeOther)
 }
 
+// handleLessonDecline lets the tutor decline lesson_id with a reason and an
+// optional message. The student is emailed if every tutor has declined.
+func (a *App) handleLessonDecline(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can decline lessons", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	allDeclined, err := a.core.DeclineLesson(lessonID, a.tutor(r).ID, r.FormValue("reason"), r.FormValue("message"))
+	if errors.Is(err, model.ErrDeclineReason) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, model.ErrRequestNotPending) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonDecline: unable to decline lesson:", err)
+		http.Error(w, "unable to decline lesson", http.StatusInternalServerError)
+		return
+	}
+
+	if allDeclined {
+		a.notifyAllDeclined(lessonID)
+	}
+
+	log.Println("lesson declined", lessonID, "by tutor", a.tutor(r).ID)
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
+// notifyAllDeclined emails the student that no tutor they asked can take the
+// lesson.
+func (a *App) notifyAllDeclined(lessonID string) {
+	lesson, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("notifyAllDeclined: unable to fetch lesson:", err)
+		return
+	}
+
+	student, err := a.repo.User(lesson.StudentID)
+	if err != nil {
+		log.Println("notifyAllDeclined: unable to fetch student:", err)
+		return
+	}
+
+	a.email.SendLessonDeclined(student.FirstName, student.Email, lesson.Title)
+}
+
 func (a *App) handleLessonDelete(w http.ResponseWriter, r *http.Request) {
 	user := a.profile(r)
 
@@ -956,7 +1191,11 @@ func (a *App) handleLessonDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.core.DeleteLesson(lessonID)
+	err = a.core.DeleteLesson(lessonID, user.User.ID)
+	if errors.Is(err, model.ErrLessonTransition) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Println("handleLessonDelete: unable to delete lesson:", err)
 		http.Error(w, "unable to delete lesson", http.StatusInternalServerError)
@@ -967,6 +1206,154 @@ func (a *App) handleLessonDelete(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/home", http.StatusSeeOther)
 }
 
+// handleLessonTutorCancel lets the tutor cancel an accepted lesson.
+func (a *App) handleLessonTutorCancel(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can cancel accepted lessons", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	err := a.core.CancelLessonByTutor(lessonID, a.tutor(r).ID, a.profile(r).User.ID)
+	if errors.Is(err, model.ErrNotLessonTutor) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, model.ErrLessonTransition) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonTutorCancel: unable to cancel lesson:", err)
+		http.Error(w, "unable to cancel lesson", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("lesson cancelled", lessonID, "by tutor", a.tutor(r).ID)
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
+// handleLessonNoShow lets the tutor record that the student didn't show up.
+func (a *App) handleLessonNoShow(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can report no-shows", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	err := a.core.MarkNoShow(lessonID, a.tutor(r).ID, a.profile(r).User.ID)
+	if errors.Is(err, model.ErrNotLessonTutor) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, model.ErrLessonTransition) || errors.Is(err, model.ErrLessonNotStarted) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonNoShow: unable to mark no-show:", err)
+		http.Error(w, "unable to mark no-show", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
+// handleSeriesAccept lets a tutor accept every lesson in the series of
+// lesson_id at once.
+func (a *App) handleSeriesAccept(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can accept lessons", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	l, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("handleSeriesAccept: unable to fetch lesson:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
+	if !l.SeriesID.Valid {
+		http.Error(w, model.ErrNotInSeries.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tutor := a.tutor(r)
+	if !tutor.MeetsRequirements(l.OnlineLesson, l.LocationID, l.SubjectID, l.LevelID) {
+		http.Error(w, "tutor does not meet lesson requirements", http.StatusForbidden)
+		return
+	}
+
+	err = a.core.AcceptSeries(l.SeriesID.String, tutor.ID)
+	if errors.Is(err, model.ErrSeriesNotAcceptable) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleSeriesAccept: unable to accept series:", err)
+		http.Error(w, "unable to accept series", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("series accepted", l.SeriesID.String, "by tutor", tutor.ID)
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
+// handleSeriesCancel lets the student cancel lesson_id and the rest of its
+// series.
+func (a *App) handleSeriesCancel(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	l, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("handleSeriesCancel: unable to fetch lesson:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
+	if l.StudentID != user.User.ID {
+		http.Error(w, "only the student who created the lesson can cancel it", http.StatusForbidden)
+		return
+	}
+
+	err = a.core.CancelSeries(lessonID, user.User.ID)
+	if errors.Is(err, model.ErrNotInSeries) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("handleSeriesCancel: unable to cancel series:", err)
+		http.Error(w, "unable to cancel series", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("series cancelled from lesson", lessonID, "by student", user.User.ID)
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
 func (a *App) handleGetTutorSummary(w http.ResponseWriter, r *http.Request) {
 	tutorID := r.URL.Query().Get("tutor_id")
 
@@ -987,6 +1374,7 @@ func (a *App) handleGetTutorSummary(w http.ResponseWriter, r *http.Request) {
 	tutorView := model.TutorView{
 		ID:            tutorID,
 		UserID:        user.ID,
+		Alias:         tutor.Alias,
 		Image:         tutor.Image,
 		OnlineLessons: tutor.OnlineLessons,
 		Bio:           tutor.Bio,
@@ -1000,9 +1388,34 @@ func (a *App) handleGetTutorSummary(w http.ResponseWriter, r *http.Request) {
 		Status:        user.Status,
 	}
 
+	contacts, err := a.repo.ContactTutors(a.profile(r).User.ID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Unable to fetch tutor", http.StatusInternalServerError)
+		return
+	}
+	if !contacts[tutorID] {
+		tutorView.HideContact()
+	}
+
+	tutorView.Rating, tutorView.RatingCount, err = a.repo.TutorRating(tutorID)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Unable to fetch tutor rating", http.StatusInternalServerError)
+		return
+	}
+
+	ratings, err := a.repo.TutorRatings(tutorID, false)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Unable to fetch tutor ratings", http.StatusInternalServerError)
+		return
+	}
+
 	page := a.view.
 		Page("tutor-summary-partial.html").
-		Add("Tutor", tutorView)
+		Add("Tutor", tutorView).
+		Add("Ratings", ratings)
 
 	if err := a.view.Execute(w, page); err != nil {
 		log.Printf("handleGetTutors: %v", err)
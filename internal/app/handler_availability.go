@@ -0,0 +1,152 @@
+package app
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"upforschool/internal/model"
+)
+
+// weekdayNames indexed by time.Weekday.
+var weekdayNames = [...]string{"Söndag", "Måndag", "Tisdag", "Onsdag", "Torsdag", "Fredag", "Lördag"}
+
+// handleAvailability shows the tutor's weekly availability and exceptions.
+func (a *App) handleAvailability(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have availability", http.StatusForbidden)
+		return
+	}
+
+	availability, err := a.repo.TutorAvailability(a.tutor(r).ID)
+	if err != nil {
+		log.Println("handleAvailability: unable to fetch availability:", err)
+		http.Error(w, "unable to fetch availability", http.StatusInternalServerError)
+		return
+	}
+
+	// monday first.
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+	page := a.view.
+		Page("availability.html").
+		Add("Availability", availability).
+		Add("Weekdays", weekdays).
+		Add("WeekdayNames", weekdayNames).
+		Add("Today", time.Now().In(model.Timezone).Format("2006-01-02"))
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleAvailability: %v", err)
+	}
+}
+
+// handleAddAvailability adds a weekly slot from weekday, start_time and
+// end_time.
+func (a *App) handleAddAvailability(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have availability", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	weekday, err := strconv.Atoi(r.FormValue("weekday"))
+	if err != nil {
+		http.Error(w, "invalid weekday", http.StatusBadRequest)
+		return
+	}
+
+	err = a.core.AddAvailability(a.tutor(r).ID, time.Weekday(weekday), r.FormValue("start_time"), r.FormValue("end_time"))
+	if errors.Is(err, model.ErrAvailabilityTime) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("handleAddAvailability: unable to add availability:", err)
+		http.Error(w, "unable to add availability", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/availability", http.StatusSeeOther)
+}
+
+// handleDeleteAvailability removes a weekly slot by id.
+func (a *App) handleDeleteAvailability(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have availability", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.core.DeleteAvailability(a.tutor(r).ID, id); err != nil {
+		log.Println("handleDeleteAvailability: unable to delete availability:", err)
+		http.Error(w, "unable to delete availability", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/availability", http.StatusSeeOther)
+}
+
+// handleAddAvailabilityException adds an exception from date, optional
+// start_time and end_time, and available ("true" adds free time).
+func (a *App) handleAddAvailabilityException(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have availability", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := a.core.AddAvailabilityException(
+		a.tutor(r).ID,
+		r.FormValue("date"),
+		r.FormValue("start_time"),
+		r.FormValue("end_time"),
+		r.FormValue("available") == "true",
+	)
+	if errors.Is(err, model.ErrAvailabilityTime) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("handleAddAvailabilityException: unable to add exception:", err)
+		http.Error(w, "unable to add availability exception", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/availability", http.StatusSeeOther)
+}
+
+// handleDeleteAvailabilityException removes an exception by id.
+func (a *App) handleDeleteAvailabilityException(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have availability", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.core.DeleteAvailabilityException(a.tutor(r).ID, id); err != nil {
+		log.Println("handleDeleteAvailabilityException: unable to delete exception:", err)
+		http.Error(w, "unable to delete availability exception", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/availability", http.StatusSeeOther)
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"upforschool/internal/model"
+)
+
+// handleBoard shows tutors the open lessons they can apply to, filtered by
+// subject, level and location ("online" for online lessons).
+func (a *App) handleBoard(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can see the lesson board", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	subjectID, _ := strconv.Atoi(q.Get("subject"))
+	levelID, _ := strconv.Atoi(q.Get("level"))
+	locationID, _ := strconv.Atoi(q.Get("location"))
+	if q.Get("location") == "online" {
+		locationID = -1
+	}
+
+	lessons, err := a.repo.OpenLessons(a.tutor(r).ID, subjectID, levelID, locationID)
+	if err != nil {
+		log.Println("handleBoard: unable to fetch open lessons:", err)
+		http.Error(w, "unable to fetch lessons", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range lessons {
+		slots, err := a.repo.LessonSlots(lessons[i].ID)
+		if err != nil {
+			log.Println("handleBoard: unable to fetch lesson slots:", err)
+			http.Error(w, "unable to fetch lessons", http.StatusInternalServerError)
+			return
+		}
+		lessons[i].Slots = slots
+	}
+
+	subjects, err := a.repo.Subjects()
+	if err != nil {
+		log.Println("handleBoard: unable to fetch subjects:", err)
+		http.Error(w, "unable to fetch subjects", http.StatusInternalServerError)
+		return
+	}
+	levels, err := a.repo.Levels()
+	if err != nil {
+		log.Println("handleBoard: unable to fetch levels:", err)
+		http.Error(w, "unable to fetch levels", http.StatusInternalServerError)
+		return
+	}
+	locations, err := a.repo.Locations()
+	if err != nil {
+		log.Println("handleBoard: unable to fetch locations:", err)
+		http.Error(w, "unable to fetch locations", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range subjects {
+		subjects[i].Selected = subjects[i].ID == subjectID
+	}
+	for i := range levels {
+		levels[i].Selected = levels[i].ID == levelID
+	}
+	for i := range locations {
+		locations[i].Selected = locations[i].ID == locationID
+	}
+
+	page := a.view.
+		Page("board.html").
+		Add("Lessons", lessons).
+		Add("Subjects", subjects).
+		Add("Levels", levels).
+		Add("Locations", locations).
+		Add("Online", locationID == -1)
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleBoard: %v", err)
+	}
+}
+
+// handleBoardApply lets a tutor apply to an open lesson_id at slot_id with a
+// message to the student.
+func (a *App) handleBoardApply(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can apply to lessons", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	l, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("handleBoardApply: unable to fetch lesson:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
+	slotID, err := strconv.ParseInt(r.FormValue("slot_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid slot_id", http.StatusBadRequest)
+		return
+	}
+
+	slot, err := a.repo.LessonSlot(slotID)
+	if err != nil || slot.LessonID != lessonID {
+		http.Error(w, model.ErrSlotUnavailable.Error(), http.StatusConflict)
+		return
+	}
+
+	tutor := a.tutor(r)
+	if !tutor.MeetsRequirements(slot.OnlineLesson, slot.LocationID, l.SubjectID, l.LevelID) {
+		http.Error(w, "tutor does not meet lesson requirements", http.StatusForbidden)
+		return
+	}
+
+	err = a.core.ApplyForLesson(lessonID, tutor.ID, slotID, r.FormValue("message"))
+	if errors.Is(err, model.ErrLessonNotOpen) || errors.Is(err, model.ErrSlotUnavailable) || errors.Is(err, model.ErrAlreadyApplied) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleBoardApply: unable to apply for lesson:", err)
+		http.Error(w, "unable to apply for lesson", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("tutor", tutor.ID, "applied for lesson", lessonID)
+	http.Redirect(w, r, "/board", http.StatusSeeOther)
+}
+
+// handleChooseApplicant lets the student pick tutor_id among the tutors who
+// applied to the open lesson_id.
+func (a *App) handleChooseApplicant(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r).User
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	tutorID := r.FormValue("tutor_id")
+
+	err := a.core.ChooseApplicant(lessonID, user.ID, tutorID)
+	if errors.Is(err, model.ErrRequestNotPending) || errors.Is(err, model.ErrLessonTaken) || errors.Is(err, model.ErrTutorBusy) ||
+		errors.Is(err, model.ErrSlotUnavailable) || errors.Is(err, model.ErrLessonTransition) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleChooseApplicant: unable to choose applicant:", err)
+		http.Error(w, "unable to choose tutor", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("lesson", lessonID, "given to applicant", tutorID, "by student", user.ID)
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
@@ -0,0 +1,285 @@
+package app
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"upforschool/internal/model"
+	"upforschool/internal/pkg/pdf"
+)
+
+var monthNames = [...]string{
+	"Januari", "Februari", "Mars", "April", "Maj", "Juni",
+	"Juli", "Augusti", "September", "Oktober", "November", "December",
+}
+
+// earningsMonth sums a month of the tutor's ledger, amounts in minor units.
+type earningsMonth struct {
+	Name       string
+	Paid       int64
+	Commission int64
+	Earned     int64
+	PaidOut    int64
+}
+
+// earningsSummary of a year of ledger lines per month and in total.
+type earningsSummary struct {
+	Year     int
+	Currency string
+	Months   [12]earningsMonth
+	Total    earningsMonth
+}
+
+func summarizeEarnings(year int, lines []model.LedgerLine) *earningsSummary {
+	s := &earningsSummary{Year: year, Currency: "SEK"}
+	for i := range s.Months {
+		s.Months[i].Name = monthNames[i]
+	}
+	s.Total.Name = "Totalt"
+
+	for _, l := range lines {
+		s.Currency = l.Currency
+
+		for _, m := range []*earningsMonth{&s.Months[l.CreatedAt.Month()-1], &s.Total} {
+			m.Paid += l.Paid
+			m.Commission += l.Commission
+			m.Earned += l.Earned
+			m.PaidOut += l.PaidOut
+		}
+	}
+
+	return s
+}
+
+// earningsYear from the year query param, the current year by default.
+func earningsYear(r *http.Request) (int, error) {
+	year := r.URL.Query().Get("year")
+	if year == "" {
+		return time.Now().Year(), nil
+	}
+	return strconv.Atoi(year)
+}
+
+// handleLessonComplete lets the tutor mark an accepted lesson as held.
+func (a *App) handleLessonComplete(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can complete lessons", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	err := a.core.CompleteLesson(lessonID, a.tutor(r).ID, a.profile(r).User.ID)
+	if errors.Is(err, model.ErrLessonNotCompletable) || errors.Is(err, model.ErrLessonNotStarted) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonComplete: unable to complete lesson:", err)
+		http.Error(w, "unable to complete lesson", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
+// handleEarnings shows the tutor's monthly earnings for a year.
+func (a *App) handleEarnings(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have earnings", http.StatusForbidden)
+		return
+	}
+
+	year, err := earningsYear(r)
+	if err != nil {
+		http.Error(w, "invalid year", http.StatusBadRequest)
+		return
+	}
+
+	tutor := a.tutor(r)
+	lines, err := a.repo.TutorLedger(tutor.ID, year)
+	if err != nil {
+		log.Println("handleEarnings: unable to fetch ledger:", err)
+		http.Error(w, "unable to fetch earnings", http.StatusInternalServerError)
+		return
+	}
+
+	balance, err := a.repo.TutorBalance(tutor.ID)
+	if err != nil {
+		log.Println("handleEarnings: unable to fetch balance:", err)
+		http.Error(w, "unable to fetch earnings", http.StatusInternalServerError)
+		return
+	}
+
+	page := a.view.
+		Page("earnings.html").
+		Add("Summary", summarizeEarnings(year, lines)).
+		Add("Lines", lines).
+		Add("Balance", balance).
+		Add("CommissionPercent", model.CommissionPercent).
+		Add("PrevYear", year-1).
+		Add("NextYear", year+1)
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleEarnings: %v", err)
+	}
+}
+
+// handleEarningsStatement downloads the tutor's annual statement as CSV or
+// PDF, for the tax return.
+func (a *App) handleEarningsStatement(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have earnings", http.StatusForbidden)
+		return
+	}
+
+	year, err := earningsYear(r)
+	if err != nil {
+		http.Error(w, "invalid year", http.StatusBadRequest)
+		return
+	}
+
+	tutor := a.tutor(r)
+	lines, err := a.repo.TutorLedger(tutor.ID, year)
+	if err != nil {
+		log.Println("handleEarningsStatement: unable to fetch ledger:", err)
+		http.Error(w, "unable to fetch earnings", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("arsbesked-%d", year)
+
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		if err := writeStatementCSV(w, lines); err != nil {
+			log.Println("handleEarningsStatement:", err)
+		}
+	case "pdf":
+		user := a.profile(r).User
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.pdf"`)
+		w.Write(statementPDF(user.FirstName+" "+user.LastName, summarizeEarnings(year, lines)))
+	default:
+		http.Error(w, "format must be csv or pdf", http.StatusBadRequest)
+	}
+}
+
+// writeStatementCSV with one row per ledger transaction, semicolon separated
+// with decimal commas the way Swedish spreadsheets expect.
+func writeStatementCSV(w io.Writer, lines []model.LedgerLine) error {
+	out := csv.NewWriter(w)
+	out.Comma = ';'
+
+	out.Write([]string{"Datum", "Typ", "Beskrivning", "Betalt av elev", "Provision", "Intäkt", "Utbetalt", "Valuta"})
+	for _, l := range lines {
+		kind := "Lektion"
+		if l.Kind == model.LedgerPayout {
+			kind = "Utbetalning"
+		}
+
+		out.Write([]string{
+			l.CreatedAt.Format("2006-01-02"),
+			kind,
+			l.Description,
+			model.Money{Amount: l.Paid}.Decimal(),
+			model.Money{Amount: l.Commission}.Decimal(),
+			model.Money{Amount: l.Earned}.Decimal(),
+			model.Money{Amount: l.PaidOut}.Decimal(),
+			l.Currency,
+		})
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// statementPDF with monthly totals for the year.
+func statementPDF(name string, s *earningsSummary) []byte {
+	money := func(amount int64) string {
+		return model.Money{Amount: amount, Currency: s.Currency}.String()
+	}
+
+	doc := pdf.New()
+	doc.Text(50, 70, 20, true, fmt.Sprintf("Årsbesked %d", s.Year))
+	doc.Text(50, 95, 10, false, name)
+	doc.Text(50, 110, 10, false, "Utskrivet: "+time.Now().Format("2006-01-02"))
+
+	companyDetails(doc, 350, 70)
+
+	columns := []float64{50, 150, 260, 360, 460}
+	header := []string{"Månad", "Betalt av elev", "Provision", "Intäkt", "Utbetalt"}
+
+	y := 160.0
+	for i, h := range header {
+		doc.Text(columns[i], y, 10, true, h)
+	}
+	doc.Line(50, y+7, 545, y+7)
+
+	for _, m := range append(s.Months[:], s.Total) {
+		y += 20
+		bold := m.Name == s.Total.Name
+		if bold {
+			doc.Line(50, y-13, 545, y-13)
+		}
+
+		for i, v := range []string{m.Name, money(m.Paid), money(m.Commission), money(m.Earned), money(m.PaidOut)} {
+			doc.Text(columns[i], y, 9, bold, v)
+		}
+	}
+
+	y += 40
+	doc.Text(50, y, 9, false, "Intäkt är din andel av elevernas betalningar efter provision.")
+	doc.Text(50, y+14, 9, false, "Information om hur du redovisar inkomsten finns hos Skatteverket, skatteverket.se.")
+
+	return doc.Bytes()
+}
+
+// handleAddPayout lets an admin record a payout to a tutor, amount in minor
+// units.
+func (a *App) handleAddPayout(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+	if !user.User.IsAdmin {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amount, err := strconv.ParseInt(r.FormValue("amount"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	}
+
+	currency := r.FormValue("currency")
+	if currency == "" {
+		currency = "SEK"
+	}
+
+	err = a.core.AddPayout(r.FormValue("tutor_id"), model.Money{Amount: amount, Currency: currency}, r.FormValue("reference"))
+	if errors.Is(err, model.ErrPayoutBalance) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleAddPayout: unable to add payout:", err)
+		http.Error(w, "unable to add payout", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"upforschool/internal/model"
+)
+
+// threadPath to the conversation about lessonID with tutorID.
+func threadPath(lessonID, tutorID string) string {
+	return "/messages?" + url.Values{"lesson_id": {lessonID}, "tutor_id": {tutorID}}.Encode()
+}
+
+// handleMessages shows the conversation about lesson_id between its student
+// and tutor_id, and marks it read.
+func (a *App) handleMessages(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r).User
+
+	lessonID := r.URL.Query().Get("lesson_id")
+	tutorID := r.URL.Query().Get("tutor_id")
+
+	thread, err := a.repo.MessageThread(lessonID, tutorID, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("handleMessages: unable to fetch thread:", err)
+		http.Error(w, "unable to fetch messages", http.StatusInternalServerError)
+		return
+	}
+	if !thread.Has(user.ID) {
+		http.Error(w, model.ErrNotParticipant.Error(), http.StatusForbidden)
+		return
+	}
+
+	messages, err := a.repo.ThreadMessages(lessonID, tutorID)
+	if err != nil {
+		log.Println("handleMessages: unable to fetch messages:", err)
+		http.Error(w, "unable to fetch messages", http.StatusInternalServerError)
+		return
+	}
+
+	if thread.Unread > 0 {
+		if err := a.core.MarkThreadRead(lessonID, tutorID, user.ID); err != nil {
+			log.Println("handleMessages: unable to mark messages read:", err)
+		}
+	}
+
+	page := a.view.
+		Page("messages.html").
+		Add("Thread", thread).
+		Add("Messages", messages).
+		Add("UserID", user.ID)
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleMessages: %v", err)
+	}
+}
+
+// handleSendMessage sends body in the conversation about lesson_id with
+// tutor_id.
+func (a *App) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r).User
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	tutorID := r.FormValue("tutor_id")
+
+	msg, notify, err := a.core.SendMessage(lessonID, tutorID, user.ID, r.FormValue("body"))
+	if errors.Is(err, model.ErrEmptyMessage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, model.ErrNotParticipant) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Println("handleSendMessage: unable to send message:", err)
+		http.Error(w, "unable to send message", http.StatusInternalServerError)
+		return
+	}
+
+	if notify {
+		a.notifyMessage(msg, user)
+	}
+
+	http.Redirect(w, r, threadPath(lessonID, tutorID), http.StatusSeeOther)
+}
+
+// handleUnreadMessages returns the number of unread messages for the nav.
+func (a *App) handleUnreadMessages(w http.ResponseWriter, r *http.Request) {
+	unread, err := a.repo.UnreadMessages(a.profile(r).User.ID)
+	if err != nil {
+		log.Println("handleUnreadMessages: unable to count messages:", err)
+		http.Error(w, "unable to count messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"unread": unread})
+}
+
+// notifyMessage tells the recipient about a new message by email.
+func (a *App) notifyMessage(msg *model.Message, sender model.User) {
+	recipient, err := a.repo.User(msg.RecipientID)
+	if err != nil {
+		log.Println("notifyMessage: unable to fetch recipient:", err)
+		return
+	}
+
+	thread, err := a.repo.MessageThread(msg.LessonID, msg.TutorID, recipient.ID)
+	if err != nil {
+		log.Println("notifyMessage: unable to fetch thread:", err)
+		return
+	}
+
+	from := sender.FirstName
+	if sender.ID == thread.TutorUserID {
+		from = thread.TutorAlias
+	}
+
+	a.email.SendNewMessage(recipient.FirstName, recipient.Email, from, thread.LessonTitle, threadPath(msg.LessonID, msg.TutorID))
+}
@@ -0,0 +1,566 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"upforschool/internal/model"
+)
+
+// parseWorldlineID strips the order prefix ("O" for orders, "S" for
+// subscriptions) from a worldline orderid.
+func parseWorldlineID(orderID, prefix string) (int64, error) {
+	if !strings.HasPrefix(orderID, prefix) {
+		return 0, errors.New("invalid worldline order ID")
+	}
+	return strconv.ParseInt(strings.TrimPrefix(orderID, prefix), 10, 64)
+}
+
+// paymentCallback from the worldline callback query.
+func paymentCallback(r *http.Request) (model.PaymentCallback, error) {
+	q := r.URL.Query()
+	amount, err := strconv.ParseInt(q.Get("amount"), 10, 64)
+	if err != nil {
+		return model.PaymentCallback{}, errors.New("invalid worldline amount")
+	}
+
+	return model.PaymentCallback{
+		TxnID:  q.Get("txnid"),
+		Amount: amount,
+		Params: r.URL.RawQuery,
+	}, nil
+}
+
+// checkoutOrder returns the lesson's order, creating it on the first checkout.
+func (a *App) checkoutOrder(lessonID, userID string) (*model.Order, error) {
+	order, err := a.repo.LessonOrder(lessonID)
+	if err == nil {
+		return order, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	orderID, err := a.core.AddOrder(&model.OrderAdd{
+		LessonID:        lessonID,
+		Quantity:        1,
+		ReferenceUser:   userID,
+		ReferenceNumber: lessonID,
+		ProductName:     model.LessonProduct.Name,
+		ProductCost:     model.LessonProduct.Cost,
+		ProductTax:      model.LessonProduct.Tax,
+		ProductCategory: model.LessonProduct.Category,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.repo.Order(orderID)
+}
+
+// handleLessonCheckout shows the order summary with a discount code field.
+func (a *App) handleLessonCheckout(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+
+	lessonID := r.URL.Query().Get("lesson_id")
+	l, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("handleLessonCheckout: unable to fetch lesson:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
+	if l.StudentID != user.User.ID {
+		http.Error(w, "only the student who created the lesson can pay for it", http.StatusForbidden)
+		return
+	}
+
+	order, err := a.checkoutOrder(lessonID, user.User.ID)
+	if err != nil {
+		log.Println("handleLessonCheckout: unable to fetch order:", err)
+		http.Error(w, "unable to fetch order", http.StatusInternalServerError)
+		return
+	}
+
+	if order.Status == model.PaymentCompleted {
+		http.Redirect(w, r, "/home", http.StatusFound)
+		return
+	}
+
+	page := a.view.
+		Page("checkout.html").
+		Add("Lesson", l).
+		Add("Order", order).
+		Add("Error", r.URL.Query().Get("error"))
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleLessonCheckout: %v", err)
+	}
+}
+
+// handleLessonCheckoutDiscount adds or, with an empty code, removes the
+// discount on the lesson's order.
+func (a *App) handleLessonCheckoutDiscount(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	code := strings.TrimSpace(r.FormValue("code"))
+	checkoutURL := "/lesson/checkout?lesson_id=" + lessonID
+
+	l, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("handleLessonCheckoutDiscount: unable to fetch lesson:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
+	if l.StudentID != user.User.ID {
+		http.Error(w, "only the student who created the lesson can pay for it", http.StatusForbidden)
+		return
+	}
+
+	order, err := a.checkoutOrder(lessonID, user.User.ID)
+	if err != nil {
+		log.Println("handleLessonCheckoutDiscount: unable to fetch order:", err)
+		http.Error(w, "unable to fetch order", http.StatusInternalServerError)
+		return
+	}
+
+	if code == "" {
+		err := a.core.RemoveDiscountFromOrder(order.ID)
+		if errors.Is(err, model.ErrPaymentTransition) {
+			http.Redirect(w, r, checkoutURL+"&error=pending", http.StatusFound)
+			return
+		}
+		if err != nil {
+			log.Println("handleLessonCheckoutDiscount: unable to remove discount:", err)
+			http.Error(w, "unable to remove discount", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, checkoutURL, http.StatusFound)
+		return
+	}
+
+	_, err = a.core.AddDiscountToOrder(order.ID, code)
+	switch {
+	case errors.Is(err, model.ErrDiscountNotFound),
+		errors.Is(err, model.ErrDiscountExpired),
+		errors.Is(err, model.ErrDiscountCurrency):
+		http.Redirect(w, r, checkoutURL+"&error=discount", http.StatusFound)
+		return
+	case errors.Is(err, model.ErrPaymentTransition):
+		http.Redirect(w, r, checkoutURL+"&error=pending", http.StatusFound)
+		return
+	case err != nil:
+		log.Println("handleLessonCheckoutDiscount: unable to add discount:", err)
+		http.Error(w, "unable to add discount", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, checkoutURL, http.StatusFound)
+}
+
+// handleLessonPay starts the worldline payment for the lesson's order.
+func (a *App) handleLessonPay(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+
+	lessonID := r.URL.Query().Get("lesson_id")
+	l, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("handleLessonPay: unable to fetch lesson:", err)
+		http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+		return
+	}
+
+	if l.StudentID != user.User.ID {
+		http.Error(w, "only the student who created the lesson can pay for it", http.StatusForbidden)
+		return
+	}
+
+	order, err := a.checkoutOrder(lessonID, user.User.ID)
+	if err != nil {
+		log.Println("handleLessonPay: unable to fetch order:", err)
+		http.Error(w, "unable to fetch order", http.StatusInternalServerError)
+		return
+	}
+
+	if order.Status == model.PaymentCompleted {
+		http.Redirect(w, r, "/home", http.StatusFound)
+		return
+	}
+
+	checkoutURL := "/lesson/checkout?lesson_id=" + lessonID
+
+	// fully discounted orders never reach worldline.
+	if order.Amount <= 0 {
+		err := a.core.CompleteOrder(order.ID)
+		if errors.Is(err, model.ErrDiscountExpired) {
+			http.Redirect(w, r, checkoutURL+"&error=discount", http.StatusFound)
+			return
+		}
+		if err != nil {
+			log.Println("handleLessonPay: unable to complete order:", err)
+			http.Error(w, "unable to complete order", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/home", http.StatusFound)
+		return
+	}
+
+	payment, err := a.core.AddOrderPayment(model.OrderPaymentRequest{
+		OrderID:   order.ID,
+		Amount:    model.Money{Amount: order.Amount, Currency: order.Currency},
+		Reference: user.User.ID,
+	})
+	if errors.Is(err, model.ErrDiscountExpired) {
+		http.Redirect(w, r, checkoutURL+"&error=discount", http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonPay: unable to add payment:", err)
+		http.Error(w, "unable to start payment", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, payment.RedirectURL, http.StatusFound)
+}
+
+// handleOrderAccept shows the confirmation page after a completed payment.
+// The lesson requests are released by the callback.
+func (a *App) handleOrderAccept(w http.ResponseWriter, r *http.Request) {
+	if !a.core.ValidateCallback(r.URL.RawQuery) {
+		log.Println("handleOrderAccept: invalid hash:", r.URL.RawQuery)
+		http.Redirect(w, r, "/home", http.StatusFound)
+		return
+	}
+
+	orderID, err := parseWorldlineID(r.URL.Query().Get("orderid"), "O")
+	if err != nil {
+		http.Redirect(w, r, "/home", http.StatusFound)
+		return
+	}
+
+	order, err := a.repo.Order(orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("handleOrderAccept: unable to fetch order:", err)
+		http.Error(w, "unable to fetch order", http.StatusInternalServerError)
+		return
+	}
+
+	userID := a.profile(r).User.ID
+
+	var lesson *model.LessonView
+	if order.LessonID.Valid {
+		lesson, err = a.repo.GetLesson(order.LessonID.String)
+		if err != nil {
+			log.Println("handleOrderAccept: unable to fetch lesson:", err)
+			http.Error(w, "unable to fetch lesson", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The accept URL is signed but not tied to a session, only the buyer may
+	// see the order.
+	if order.ReferenceUser != userID && (lesson == nil || lesson.StudentID != userID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	page := a.view.
+		Page("payment-accept.html").
+		Add("Order", order).
+		Add("Lesson", lesson)
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleOrderAccept: %v", err)
+	}
+}
+
+func (a *App) handleOrderCancel(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/home", http.StatusFound)
+}
+
+// handleOrderCallback is called by worldline when an order payment is completed.
+func (a *App) handleOrderCallback(w http.ResponseWriter, r *http.Request) {
+	if !a.core.ValidateCallback(r.URL.RawQuery) {
+		log.Println("handleOrderCallback: invalid hash:", r.URL.RawQuery)
+		http.Error(w, "invalid hash", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	orderID, err := parseWorldlineID(q.Get("orderid"), "O")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cb, err := paymentCallback(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = a.core.CompleteOrderPayment(orderID, cb)
+	switch {
+	case errors.Is(err, model.ErrDuplicateCallback):
+		log.Println("handleOrderCallback: duplicate callback:", cb.TxnID)
+	case errors.Is(err, model.ErrPaymentAmount):
+		log.Println("handleOrderCallback:", err)
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Println("handleOrderCallback: unable to complete order:", err)
+		http.Error(w, "unable to complete order", http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil {
+		a.sendReceipt(fmt.Sprintf("O%d", orderID))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// refundOrder through worldline and tell the student.
+func (a *App) refundOrder(id int64, reason string) error {
+	if err := a.core.RefundOrder(id, reason); err != nil {
+		return err
+	}
+
+	n, err := a.repo.RefundNotice(id)
+	if err != nil {
+		return err
+	}
+
+	amount := model.Money{Amount: n.Amount, Currency: n.Currency}
+	a.email.SendRefundNotice(n.FirstName, n.Email, n.Title, amount.String())
+	return nil
+}
+
+// handleOrderRefund lets an admin refund a paid lesson order.
+func (a *App) handleOrderRefund(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+	if !user.User.IsAdmin {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orderID, err := strconv.ParseInt(r.FormValue("order_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "admin"
+	}
+
+	err = a.refundOrder(orderID, reason)
+	switch {
+	case errors.Is(err, model.ErrPaymentTransition),
+		errors.Is(err, model.ErrRefundNoTransaction),
+		errors.Is(err, model.ErrRefundLessonHeld):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Println("handleOrderRefund: unable to refund order:", err)
+		http.Error(w, "unable to refund order", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"orderID": strconv.FormatInt(orderID, 10),
+		"status":  model.PaymentRefunded,
+	})
+}
+
+func (a *App) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+
+	plans, err := a.repo.Plans(model.ActiveRole(user.User.ActiveRole))
+	if err != nil {
+		log.Println("handleSubscriptions: unable to fetch plans:", err)
+		http.Error(w, "unable to fetch plans", http.StatusInternalServerError)
+		return
+	}
+
+	sub, err := a.repo.ActiveSubscription(user.User.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("handleSubscriptions: unable to fetch subscription:", err)
+		http.Error(w, "unable to fetch subscription", http.StatusInternalServerError)
+		return
+	}
+
+	page := a.view.
+		Page("subscriptions.html").
+		Add("Plans", plans).
+		Add("Subscription", sub).
+		Add("Error", r.URL.Query().Get("error"))
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleSubscriptions: %v", err)
+	}
+}
+
+func (a *App) handleSubscriptionCheckout(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	planID, err := strconv.ParseInt(r.FormValue("plan_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid plan", http.StatusBadRequest)
+		return
+	}
+
+	subscriptionID, err := a.core.AddSubscription(&model.SubscriptionAdd{
+		PlanID:       planID,
+		UserID:       user.User.ID,
+		Reference:    user.User.ID,
+		DiscountCode: strings.TrimSpace(r.FormValue("code")),
+	})
+	if errors.Is(err, model.ErrDiscountNotFound) ||
+		errors.Is(err, model.ErrDiscountExpired) ||
+		errors.Is(err, model.ErrDiscountCurrency) {
+		http.Redirect(w, r, "/subscriptions?error=discount", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Println("handleSubscriptionCheckout: unable to add subscription:", err)
+		http.Error(w, "unable to add subscription", http.StatusInternalServerError)
+		return
+	}
+
+	sub, err := a.repo.Subscription(subscriptionID)
+	if err != nil {
+		log.Println("handleSubscriptionCheckout: unable to fetch subscription:", err)
+		http.Error(w, "unable to fetch subscription", http.StatusInternalServerError)
+		return
+	}
+
+	// fully discounted subscriptions never reach worldline.
+	if sub.Amount <= 0 {
+		if err := a.core.CompleteSubscription(sub.ID); err != nil {
+			log.Println("handleSubscriptionCheckout: unable to activate subscription:", err)
+			http.Error(w, "unable to activate subscription", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	payment, err := a.core.AddSubscriptionPayment(model.SubscriptionPaymentRequest{
+		SubscriptionID: sub.ID,
+		Amount:         model.Money{Amount: sub.Amount, Currency: sub.Currency},
+		Reference:      user.User.ID,
+	})
+	if err != nil {
+		log.Println("handleSubscriptionCheckout: unable to add payment:", err)
+		http.Error(w, "unable to start payment", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, payment.RedirectURL, http.StatusSeeOther)
+}
+
+func (a *App) handleSubscriptionAccept(w http.ResponseWriter, r *http.Request) {
+	if !a.core.ValidateCallback(r.URL.RawQuery) {
+		log.Println("handleSubscriptionAccept: invalid hash:", r.URL.RawQuery)
+		http.Redirect(w, r, "/profile", http.StatusFound)
+		return
+	}
+
+	subscriptionID, err := parseWorldlineID(r.URL.Query().Get("orderid"), "S")
+	if err != nil {
+		http.Redirect(w, r, "/profile", http.StatusFound)
+		return
+	}
+
+	subscription, err := a.repo.Subscription(subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("handleSubscriptionAccept: unable to fetch subscription:", err)
+		http.Error(w, "unable to fetch subscription", http.StatusInternalServerError)
+		return
+	}
+	if subscription.UserID != a.profile(r).User.ID {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusFound)
+}
+
+func (a *App) handleSubscriptionCancel(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/profile", http.StatusFound)
+}
+
+// handleSubscriptionCallback is called by worldline when a subscription payment is completed.
+func (a *App) handleSubscriptionCallback(w http.ResponseWriter, r *http.Request) {
+	if !a.core.ValidateCallback(r.URL.RawQuery) {
+		log.Println("handleSubscriptionCallback: invalid hash:", r.URL.RawQuery)
+		http.Error(w, "invalid hash", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	subscriptionID, err := parseWorldlineID(q.Get("orderid"), "S")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cb, err := paymentCallback(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = a.core.CompleteSubscriptionPayment(subscriptionID, cb)
+	switch {
+	case errors.Is(err, model.ErrDuplicateCallback):
+		log.Println("handleSubscriptionCallback: duplicate callback:", cb.TxnID)
+	case errors.Is(err, model.ErrPaymentAmount):
+		log.Println("handleSubscriptionCallback:", err)
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Println("handleSubscriptionCallback: unable to complete subscription:", err)
+		http.Error(w, "unable to complete subscription", http.StatusInternalServerError)
+		return
+	}
+
+	if err == nil {
+		a.sendReceipt(fmt.Sprintf("S%d", subscriptionID))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"upforschool/internal/model"
+)
+
+// handleLessonRate lets the student grade lesson_id 1-5 with feedback.
+func (a *App) handleLessonRate(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r).User
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	grade, err := strconv.Atoi(r.FormValue("grade"))
+	if err != nil {
+		http.Error(w, "invalid grade", http.StatusBadRequest)
+		return
+	}
+
+	lessonID := r.FormValue("lesson_id")
+	err = a.core.RateLesson(lessonID, user.ID, grade, r.FormValue("feedback"))
+	if errors.Is(err, model.ErrRatingGrade) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, model.ErrNotRateable) || errors.Is(err, model.ErrAlreadyRated) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("handleLessonRate: unable to rate lesson:", err)
+		http.Error(w, "unable to rate lesson", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("lesson", lessonID, "rated", grade, "by student", user.ID)
+	http.Redirect(w, r, "/home", http.StatusSeeOther)
+}
+
+// handleRatings shows tutors their ratings, hidden ones included, to reply to.
+func (a *App) handleRatings(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors have ratings", http.StatusForbidden)
+		return
+	}
+
+	tutorID := a.tutor(r).ID
+	ratings, err := a.repo.TutorRatings(tutorID, true)
+	if err != nil {
+		log.Println("handleRatings: unable to fetch ratings:", err)
+		http.Error(w, "unable to fetch ratings", http.StatusInternalServerError)
+		return
+	}
+
+	avg, count, err := a.repo.TutorRating(tutorID)
+	if err != nil {
+		log.Println("handleRatings: unable to fetch rating:", err)
+		http.Error(w, "unable to fetch ratings", http.StatusInternalServerError)
+		return
+	}
+
+	page := a.view.
+		Page("ratings.html").
+		Add("Ratings", ratings).
+		Add("Rating", avg).
+		Add("RatingCount", count)
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleRatings: %v", err)
+	}
+}
+
+// handleRatingReply lets the tutor reply to rating_id, an empty reply removes
+// it.
+func (a *App) handleRatingReply(w http.ResponseWriter, r *http.Request) {
+	if !a.activeTutor(r) {
+		http.Error(w, "only tutors can reply to ratings", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ratingID, err := strconv.ParseInt(r.FormValue("rating_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid rating ID", http.StatusBadRequest)
+		return
+	}
+
+	err = a.core.ReplyToRating(ratingID, a.tutor(r).ID, r.FormValue("reply"))
+	if errors.Is(err, model.ErrRatingNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("handleRatingReply: unable to reply to rating:", err)
+		http.Error(w, "unable to reply to rating", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/ratings", http.StatusSeeOther)
+}
+
+// handleRatingHide lets an admin hide an abusive rating_id, or show it again
+// with hidden=false.
+func (a *App) handleRatingHide(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+	if !user.User.IsAdmin {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ratingID, err := strconv.ParseInt(r.FormValue("rating_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid rating ID", http.StatusBadRequest)
+		return
+	}
+
+	hidden := r.FormValue("hidden") != "false"
+	err = a.core.HideRating(ratingID, hidden)
+	if errors.Is(err, model.ErrRatingNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("handleRatingHide: unable to hide rating:", err)
+		http.Error(w, "unable to hide rating", http.StatusInternalServerError)
+		return
+	}
+
+	log.Println("rating", ratingID, "hidden", hidden, "by admin", user.User.ID)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"ratingID": strconv.FormatInt(ratingID, 10),
+		"hidden":   hidden,
+	})
+}
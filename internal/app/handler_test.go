@@ -0,0 +1,217 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"upforschool/internal/model"
+)
+
+func TestHideTutorContacts(t *testing.T) {
+	newTutors := func() []model.TutorView {
+		return []model.TutorView{
+			{ID: "accepted", Email: "accepted@example.com", Phone: "0701"},
+			{ID: "asked", Email: "asked@example.com", Phone: "0702"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		contacts map[string]bool
+		shown    map[string]bool
+	}{
+		{"no lessons", nil, map[string]bool{}},
+		{"accepted lesson", map[string]bool{"accepted": true}, map[string]bool{"accepted": true}},
+		{"both accepted", map[string]bool{"accepted": true, "asked": true}, map[string]bool{"accepted": true, "asked": true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tutors := newTutors()
+			hideTutorContacts(tt.contacts, tutors)
+
+			for i, tutor := range tutors {
+				want := newTutors()[i]
+				if !tt.shown[tutor.ID] {
+					want.Email, want.Phone = "", ""
+				}
+				if tutor.Email != want.Email || tutor.Phone != want.Phone {
+					t.Errorf("tutor %s contact = %q %q, want %q %q", tutor.ID, tutor.Email, tutor.Phone, want.Email, want.Phone)
+				}
+			}
+		})
+	}
+}
+
+// TestTutorContactsToStudent only shows a tutor's contact details to the
+// student once the tutor has accepted one of their lessons, on every page
+// listing the tutor.
+func TestTutorContactsToStudent(t *testing.T) {
+	a, db := testApp(t)
+
+	student := addTestUser(t, db, "Elev")
+	tutorUser := addTestUser(t, db, "Coach")
+	tutor := addTestTutor(t, db, tutorUser)
+	email, phone := testContact(t, db, tutorUser)
+
+	subjectID, levelID, _ := seededIDs(t, db)
+	lesson := addTestLesson(t, db, student, time.Now().Add(48*time.Hour).Truncate(time.Minute), false)
+	addTestRequest(t, db, lesson, tutor, model.LessonRequestPending)
+
+	// tutorViews of the tutor by page.
+	tutorViews := func() map[string]model.TutorView {
+		views := make(map[string]model.TutorView)
+
+		var summary struct{ Tutor model.TutorView }
+		servePage(t, a, a.handleGetTutorSummary, student, "/tutor/summary?tutor_id="+tutor, &summary)
+		views["summary"] = summary.Tutor
+
+		var list struct{ Tutors []model.TutorView }
+		servePage(t, a, a.handleGetTutors, student, fmt.Sprintf("/tutors/list?subject=%d&level=%d&location=online", subjectID, levelID), &list)
+		for _, tv := range list.Tutors {
+			if tv.ID == tutor {
+				views["tutors"] = tv
+			}
+		}
+
+		var lessons struct{ Lessons []model.LessonView }
+		servePage(t, a, a.handleListLessons, student, "/lessons/list", &lessons)
+		for _, l := range lessons.Lessons {
+			for _, tv := range l.Tutors {
+				if l.ID == lesson && tv.ID == tutor {
+					views["lessons"] = tv
+				}
+			}
+		}
+
+		for _, page := range []string{"summary", "tutors", "lessons"} {
+			if _, ok := views[page]; !ok {
+				t.Fatalf("tutor missing from %s", page)
+			}
+		}
+		return views
+	}
+
+	for page, tv := range tutorViews() {
+		if tv.Email != "" || tv.Phone != "" {
+			t.Errorf("%s before acceptance shows contact %q %q, want none", page, tv.Email, tv.Phone)
+		}
+	}
+
+	setTestLessonTutor(t, db, lesson, tutor, model.LessonAccepted)
+
+	for page, tv := range tutorViews() {
+		if tv.Email != email || tv.Phone != phone {
+			t.Errorf("%s after acceptance shows contact %q %q, want %q %q", page, tv.Email, tv.Phone, email, phone)
+		}
+	}
+}
+
+// TestApplicantContacts keeps the contact details of a tutor applying to an
+// open lesson and of its student hidden until the student chooses the tutor.
+func TestApplicantContacts(t *testing.T) {
+	a, db := testApp(t)
+
+	student := addTestUser(t, db, "Elev")
+	tutorUser := addTestUser(t, db, "Coach")
+	tutor := addTestTutor(t, db, tutorUser)
+	tutorEmail, tutorPhone := testContact(t, db, tutorUser)
+	studentEmail, studentPhone := testContact(t, db, student)
+
+	lesson := addTestLesson(t, db, student, time.Now().Add(48*time.Hour).Truncate(time.Minute), true)
+
+	var board struct{ Lessons []model.LessonView }
+	servePage(t, a, a.handleBoard, tutorUser, "/board", &board)
+	found := false
+	for _, l := range board.Lessons {
+		if l.ID == lesson {
+			found = true
+			if l.StudentEmail != "" || l.StudentPhone != "" {
+				t.Errorf("board shows student contact %q %q, want none", l.StudentEmail, l.StudentPhone)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("open lesson missing from the board")
+	}
+
+	addTestRequest(t, db, lesson, tutor, model.LessonRequestApplied)
+
+	// contacts the student sees of the applicant, and the tutor of the
+	// student, in their lesson lists. Tutors only list the lessons they
+	// applied to once chosen.
+	contacts := func() (model.TutorView, model.LessonView) {
+		var applicant model.TutorView
+		var lessons struct{ Lessons []model.LessonView }
+		servePage(t, a, a.handleListLessons, student, "/lessons/list", &lessons)
+		for _, l := range lessons.Lessons {
+			for _, tv := range l.Tutors {
+				if l.ID == lesson && tv.ID == tutor {
+					applicant = tv
+				}
+			}
+		}
+		if applicant.ID == "" {
+			t.Fatal("applicant missing from the student's lessons")
+		}
+
+		var received model.LessonView
+		lessons.Lessons = nil
+		servePage(t, a, a.handleListLessons, tutorUser, "/lessons/list", &lessons)
+		for _, l := range lessons.Lessons {
+			if l.ID == lesson {
+				received = l
+			}
+		}
+		return applicant, received
+	}
+
+	applicant, received := contacts()
+	if applicant.Email != "" || applicant.Phone != "" {
+		t.Errorf("applicant shows contact %q %q, want none", applicant.Email, applicant.Phone)
+	}
+	if received.StudentEmail != "" || received.StudentPhone != "" {
+		t.Errorf("applied lesson shows student contact %q %q, want none", received.StudentEmail, received.StudentPhone)
+	}
+
+	setTestLessonTutor(t, db, lesson, tutor, model.LessonAccepted)
+
+	applicant, received = contacts()
+	if received.ID == "" {
+		t.Fatal("accepted lesson missing from the tutor's lessons")
+	}
+	if applicant.Email != tutorEmail || applicant.Phone != tutorPhone {
+		t.Errorf("chosen applicant shows contact %q %q, want %q %q", applicant.Email, applicant.Phone, tutorEmail, tutorPhone)
+	}
+	if received.StudentEmail != studentEmail || received.StudentPhone != studentPhone {
+		t.Errorf("accepted lesson shows student contact %q %q, want %q %q", received.StudentEmail, received.StudentPhone, studentEmail, studentPhone)
+	}
+}
+
+// TestMessageThreadContacts never shows the other side's contact details in
+// a message thread before the lesson is accepted, they talk through the
+// messages until then.
+func TestMessageThreadContacts(t *testing.T) {
+	a, db := testApp(t)
+
+	student := addTestUser(t, db, "Elev")
+	tutorUser := addTestUser(t, db, "Coach")
+	tutor := addTestTutor(t, db, tutorUser)
+
+	lesson := addTestLesson(t, db, student, time.Now().Add(48*time.Hour).Truncate(time.Minute), false)
+	addTestRequest(t, db, lesson, tutor, model.LessonRequestPending)
+
+	if _, _, err := a.core.SendMessage(lesson, tutor, student, "Hej!"); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	target := threadPath(lesson, tutor)
+	for _, tt := range []struct{ viewer, other string }{{student, tutorUser}, {tutorUser, student}} {
+		body := string(serve(t, a, a.handleMessages, tt.viewer, target))
+		email, phone := testContact(t, db, tt.other)
+		if strings.Contains(body, email) || strings.Contains(body, phone) {
+			t.Errorf("thread seen by %s shows the contact of %s", tt.viewer, tt.other)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"upforschool/internal/model"
+)
+
+// tutorsPerPage in the tutor directory.
+const tutorsPerPage = 20
+
+// pageURL is path at page with the same query otherwise.
+func pageURL(path string, query url.Values, page int) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("page", strconv.Itoa(page))
+	return path + "?" + q.Encode()
+}
+
+// tutorFilter and page number from the directory query: subject, level,
+// location ("online" for tutors giving online lessons) and page.
+func tutorFilter(q url.Values) (model.TutorFilter, int) {
+	var f model.TutorFilter
+	f.SubjectID, _ = strconv.Atoi(q.Get("subject"))
+	f.LevelID, _ = strconv.Atoi(q.Get("level"))
+	if q.Get("location") == "online" {
+		f.Online = true
+	} else {
+		f.LocationID, _ = strconv.Atoi(q.Get("location"))
+	}
+
+	pageNo, _ := strconv.Atoi(q.Get("page"))
+	if pageNo < 1 {
+		pageNo = 1
+	}
+	return f, pageNo
+}
+
+// handleTutors is the public tutor directory.
+func (a *App) handleTutors(w http.ResponseWriter, r *http.Request) {
+	f, pageNo := tutorFilter(r.URL.Query())
+
+	tutors, total, err := a.repo.AllTutors(f, tutorsPerPage, (pageNo-1)*tutorsPerPage)
+	if err != nil {
+		log.Println("handleTutors: unable to fetch tutors:", err)
+		http.Error(w, "unable to fetch tutors", http.StatusInternalServerError)
+		return
+	}
+
+	a.tutorDirectory(w, r, f, tutors, total, pageNo)
+}
+
+// handleSearch searches the tutor directory for q, with the directory's
+// filters. Without q it's the directory.
+func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		query.Del("q")
+		http.Redirect(w, r, "/tutors?"+query.Encode(), http.StatusSeeOther)
+		return
+	}
+
+	f, pageNo := tutorFilter(query)
+
+	tutors, total, err := a.repo.SearchTutors(q, f, tutorsPerPage, (pageNo-1)*tutorsPerPage)
+	if err != nil {
+		log.Println("handleSearch: unable to search tutors:", err)
+		http.Error(w, "unable to search tutors", http.StatusInternalServerError)
+		return
+	}
+
+	a.tutorDirectory(w, r, f, tutors, total, pageNo)
+}
+
+// tutorDirectory renders a page of tutors with the filters f.
+func (a *App) tutorDirectory(w http.ResponseWriter, r *http.Request, f model.TutorFilter, tutors []model.TutorView, total, pageNo int) {
+	q := r.URL.Query()
+
+	subjects, err := a.repo.Subjects()
+	if err != nil {
+		log.Println("tutorDirectory: unable to fetch subjects:", err)
+		http.Error(w, "unable to fetch subjects", http.StatusInternalServerError)
+		return
+	}
+	levels, err := a.repo.Levels()
+	if err != nil {
+		log.Println("tutorDirectory: unable to fetch levels:", err)
+		http.Error(w, "unable to fetch levels", http.StatusInternalServerError)
+		return
+	}
+	locations, err := a.repo.Locations()
+	if err != nil {
+		log.Println("tutorDirectory: unable to fetch locations:", err)
+		http.Error(w, "unable to fetch locations", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range subjects {
+		subjects[i].Selected = subjects[i].ID == f.SubjectID
+	}
+	for i := range levels {
+		levels[i].Selected = levels[i].ID == f.LevelID
+	}
+	for i := range locations {
+		locations[i].Selected = locations[i].ID == f.LocationID
+	}
+
+	pages := (total + tutorsPerPage - 1) / tutorsPerPage
+	user, _ := a.loggedInUser(r)
+
+	page := a.view.
+		Page("tutors-list.html").
+		Add("LoggedIn", user != nil).
+		Add("Query", q.Get("q")).
+		Add("Tutors", tutors).
+		Add("Total", total).
+		Add("Subjects", subjects).
+		Add("Levels", levels).
+		Add("Locations", locations).
+		Add("Online", f.Online).
+		Add("Page", pageNo).
+		Add("Pages", pages)
+
+	if pageNo > 1 {
+		page.Add("PrevURL", pageURL(r.URL.Path, q, pageNo-1))
+	}
+	if pageNo < pages {
+		page.Add("NextURL", pageURL(r.URL.Path, q, pageNo+1))
+	}
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("tutorDirectory: %v", err)
+	}
+}
+
+// handleTutorProfile is the public profile of the tutor with alias.
+func (a *App) handleTutorProfile(w http.ResponseWriter, r *http.Request) {
+	tutor, err := a.repo.TutorByAlias(r.PathValue("alias"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("handleTutorProfile: unable to fetch tutor:", err)
+		http.Error(w, "unable to fetch tutor", http.StatusInternalServerError)
+		return
+	}
+
+	tutorUser, err := a.repo.User(tutor.UserID)
+	if err != nil {
+		log.Println("handleTutorProfile: unable to fetch tutor user:", err)
+		http.Error(w, "unable to fetch tutor", http.StatusInternalServerError)
+		return
+	}
+	if tutorUser.Status != "CONFIRMED" {
+		http.NotFound(w, r)
+		return
+	}
+
+	rating, count, err := a.repo.TutorRating(tutor.ID)
+	if err != nil {
+		log.Println("handleTutorProfile: unable to fetch rating:", err)
+		http.Error(w, "unable to fetch tutor", http.StatusInternalServerError)
+		return
+	}
+
+	ratings, err := a.repo.TutorRatings(tutor.ID, false)
+	if err != nil {
+		log.Println("handleTutorProfile: unable to fetch ratings:", err)
+		http.Error(w, "unable to fetch tutor", http.StatusInternalServerError)
+		return
+	}
+
+	user, _ := a.loggedInUser(r)
+
+	page := a.view.
+		Page("tutor-profile.html").
+		Add("LoggedIn", user != nil).
+		Add("Tutor", tutor).
+		Add("Rating", rating).
+		Add("RatingCount", count).
+		Add("Ratings", ratings)
+
+	if err := a.view.Execute(w, page); err != nil {
+		log.Printf("handleTutorProfile: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"log"
+	"slices"
+	"time"
+	"upforschool/internal/model"
+)
+
+// subscriptionReminderDays before ends_at the student is reminded to renew.
+const subscriptionReminderDays = 7
+
+// refundUnacceptedDays after payment a lesson no tutor has accepted is
+// refunded.
+const refundUnacceptedDays = 14
+
+// Defaults for config Lessons: days a tutor has to answer a lesson request
+// and days after a lesson is over that it's archived.
+const (
+	defaultRequestExpiryDays = 3
+	defaultArchiveAfterDays  = 7
+)
+
+// suggestedTutors in the email when a lesson request expires.
+const suggestedTutors = 3
+
+// runSubscriptionReminders emails students whose subscription is about to
+// end, checking every interval.
+func (a *App) runSubscriptionReminders(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.sendSubscriptionReminders()
+		<-ticker.C
+	}
+}
+
+func (a *App) sendSubscriptionReminders() {
+	reminders, err := a.repo.ExpiringSubscriptions(subscriptionReminderDays)
+	if err != nil {
+		log.Println("sendSubscriptionReminders: unable to fetch subscriptions:", err)
+		return
+	}
+
+	for _, s := range reminders {
+		a.email.SendSubscriptionReminder(s.FirstName, s.Email, s.PlanName, s.EndsAt)
+
+		if err := a.core.MarkSubscriptionReminded(s.ID); err != nil {
+			log.Println("sendSubscriptionReminders: unable to mark subscription:", s.ID, err)
+		}
+	}
+}
+
+// runUnacceptedRefunds refunds paid lessons no tutor has accepted, checking
+// every interval.
+func (a *App) runUnacceptedRefunds(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		a.refundUnacceptedOrders()
+		<-ticker.C
+	}
+}
+
+func (a *App) refundUnacceptedOrders() {
+	orders, err := a.repo.UnacceptedOrders(refundUnacceptedDays)
+	if err != nil {
+		log.Println("refundUnacceptedOrders: unable to fetch orders:", err)
+		return
+	}
+
+	for _, id := range orders {
+		if err := a.refundOrder(id, "not accepted by a tutor"); err != nil {
+			log.Println("refundUnacceptedOrders: unable to refund order:", id, err)
+		}
+	}
+}
+
+// runLessonExpiry expires unanswered lesson requests and archives old
+// lessons, checking every interval.
+func (a *App) runLessonExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	expiry, archive := a.config.Lessons.RequestExpiryDays, a.config.Lessons.ArchiveAfterDays
+	if expiry <= 0 {
+		expiry = defaultRequestExpiryDays
+	}
+	if archive <= 0 {
+		archive = defaultArchiveAfterDays
+	}
+
+	for {
+		a.expireLessonRequests(time.Duration(expiry) * 24 * time.Hour)
+
+		if _, err := a.core.ArchiveLessons(time.Duration(archive) * 24 * time.Hour); err != nil {
+			log.Println("runLessonExpiry: unable to archive lessons:", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (a *App) expireLessonRequests(age time.Duration) {
+	lessons, err := a.core.ExpireLessonRequests(age)
+	if err != nil {
+		log.Println("expireLessonRequests: unable to expire requests:", err)
+		return
+	}
+
+	for _, id := range lessons {
+		a.notifyExpired(id)
+	}
+}
+
+// notifyExpired emails the student of a lesson no tutor answered, with other
+// tutors who could take it.
+func (a *App) notifyExpired(lessonID string) {
+	lesson, err := a.repo.GetLesson(lessonID)
+	if err != nil {
+		log.Println("notifyExpired: unable to fetch lesson:", err)
+		return
+	}
+
+	student, err := a.repo.User(lesson.StudentID)
+	if err != nil {
+		log.Println("notifyExpired: unable to fetch student:", err)
+		return
+	}
+
+	asked, err := a.repo.LessonTutors(lessonID)
+	if err != nil {
+		log.Println("notifyExpired: unable to fetch lesson tutors:", err)
+		return
+	}
+
+	tutors, err := a.repo.Tutors(lesson.OnlineLesson, lesson.LocationID, lesson.SubjectID, lesson.LevelID, nil)
+	if err != nil {
+		log.Println("notifyExpired: unable to fetch tutors:", err)
+		return
+	}
+
+	var suggestions []string
+	for _, t := range tutors {
+		if len(suggestions) == suggestedTutors {
+			break
+		}
+		if !slices.ContainsFunc(asked, func(at model.TutorView) bool { return at.ID == t.ID }) {
+			suggestions = append(suggestions, t.Alias)
+		}
+	}
+
+	a.email.SendLessonExpired(student.FirstName, student.Email, lesson.Title, suggestions)
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"upforschool/internal/model"
+	"upforschool/internal/pkg/pdf"
+	"upforschool/internal/postmark"
+)
+
+// receipt by number, "O" followed by an order ID or "S" followed by a
+// subscription ID. Malformed numbers return sql.ErrNoRows.
+func (a *App) receipt(number string) (*model.Receipt, error) {
+	if strings.HasPrefix(number, "S") {
+		id, err := parseWorldlineID(number, "S")
+		if err != nil {
+			return nil, sql.ErrNoRows
+		}
+		return a.repo.SubscriptionReceipt(id)
+	}
+
+	id, err := parseWorldlineID(number, "O")
+	if err != nil {
+		return nil, sql.ErrNoRows
+	}
+	return a.repo.OrderReceipt(id)
+}
+
+// companyDetails from postmark.DefaultParams at x, y.
+func companyDetails(doc *pdf.Document, x, y float64) {
+	for _, key := range []string{"company_name", "company_address", "company_org_number", "product_url"} {
+		if v := postmark.DefaultParams[key]; v != "" {
+			doc.Text(x, y, 10, key == "company_name", v)
+			y += 15
+		}
+	}
+}
+
+// receiptPDF with the company details, the discount and a VAT breakdown.
+func receiptPDF(r *model.Receipt) []byte {
+	money := func(amount int64) string {
+		return model.Money{Amount: amount, Currency: r.Currency}.String()
+	}
+
+	doc := pdf.New()
+	doc.Text(50, 70, 20, true, "Kvitto")
+	doc.Text(50, 95, 10, false, "Kvittonummer: "+r.Number)
+	doc.Text(50, 110, 10, false, "Datum: "+r.PaidAt.Format("2006-01-02"))
+
+	companyDetails(doc, 350, 70)
+
+	// buyer
+	doc.Text(50, 150, 10, true, "Kund")
+	doc.Text(50, 165, 10, false, r.FirstName+" "+r.LastName)
+	doc.Text(50, 180, 10, false, r.Email)
+
+	doc.Text(50, 230, 10, true, "Beskrivning")
+	doc.Text(300, 230, 10, true, "Antal")
+	doc.Text(400, 230, 10, true, "Belopp")
+	doc.Line(50, 237, 545, 237)
+
+	y := 255.0
+	doc.Text(50, y, 10, false, r.ProductName)
+	doc.Text(300, y, 10, false, fmt.Sprint(r.Quantity))
+	doc.Text(400, y, 10, false, money(r.Price*int64(r.Quantity)))
+
+	if r.DiscountAmount > 0 {
+		y += 18
+		doc.Text(50, y, 10, false, "Rabatt")
+		doc.Text(400, y, 10, false, money(-r.DiscountAmount))
+	}
+
+	y += 12
+	doc.Line(50, y, 545, y)
+
+	y += 18
+	doc.Text(250, y, 10, false, "Belopp exkl. moms")
+	doc.Text(400, y, 10, false, money(r.Amount-r.TaxAmount))
+	y += 15
+	doc.Text(250, y, 10, false, fmt.Sprintf("Moms %d%%", r.TaxRate))
+	doc.Text(400, y, 10, false, money(r.TaxAmount))
+	y += 15
+	doc.Text(250, y, 10, true, "Totalt")
+	doc.Text(400, y, 10, true, money(r.Amount))
+
+	if r.Status == model.PaymentRefunded {
+		y += 30
+		doc.Text(50, y, 10, true, "Betalningen har återbetalats.")
+	}
+
+	return doc.Bytes()
+}
+
+// handleReceipt downloads the PDF receipt for one of the user's payments.
+func (a *App) handleReceipt(w http.ResponseWriter, r *http.Request) {
+	user := a.profile(r)
+
+	number := r.PathValue("number")
+	receipt, err := a.receipt(number)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Println("handleReceipt: unable to fetch receipt:", err)
+		http.Error(w, "unable to fetch receipt", http.StatusInternalServerError)
+		return
+	}
+
+	if receipt.UserID != user.User.ID {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="kvitto-`+receipt.Number+`.pdf"`)
+	w.Write(receiptPDF(receipt))
+}
+
+// sendReceipt emails the PDF receipt for number to the payer.
+func (a *App) sendReceipt(number string) {
+	receipt, err := a.receipt(number)
+	if err != nil {
+		log.Println("sendReceipt: unable to fetch receipt:", number, err)
+		return
+	}
+
+	a.email.SendReceipt(receipt.FirstName, receipt.Email, receipt.Number, receiptPDF(receipt))
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Period of time starting at Start, e.g. a proposed lesson.
+type Period struct {
+	Start    time.Time `json:"startAt"`
+	Duration int       `json:"duration"` // minutes
+}
+
+// End of the period.
+func (p Period) End() time.Time {
+	return p.Start.Add(time.Duration(p.Duration) * time.Minute)
+}
+
+// Overlaps reports whether p and o share any time.
+func (p Period) Overlaps(o Period) bool {
+	return p.Start.Before(o.End()) && o.Start.Before(p.End())
+}
+
+// AvailabilitySlot is a weekly recurring time the tutor is free. Times are
+// "15:04" in Timezone.
+type AvailabilitySlot struct {
+	ID        int64        `db:"id"`
+	TutorID   string       `db:"tutor_id"`
+	Weekday   time.Weekday `db:"weekday"`
+	StartTime string       `db:"start_time"`
+	EndTime   string       `db:"end_time"`
+}
+
+// AvailabilityException overrides the weekly availability on Date, either
+// blocking time or adding free time. Without times it covers the whole day.
+type AvailabilityException struct {
+	ID        int64          `db:"id"`
+	TutorID   string         `db:"tutor_id"`
+	Date      string         `db:"date"` // "2006-01-02"
+	StartTime sql.NullString `db:"start_time"`
+	EndTime   sql.NullString `db:"end_time"`
+	Available bool           `db:"available"`
+}
+
+// Availability of a tutor, the weekly slots with exceptions and the accepted
+// lessons that already take up time.
+type Availability struct {
+	Weekly     []AvailabilitySlot
+	Exceptions []AvailabilityException
+	Booked     []Period
+}
+
+// IsSet reports whether the tutor has said when they are free at all.
+func (a *Availability) IsSet() bool {
+	return len(a.Weekly) > 0 || len(a.Exceptions) > 0
+}
+
+// Covers reports whether the tutor is free for all of p. Lessons over
+// midnight are only covered by whole day exceptions.
+func (a *Availability) Covers(p Period) bool {
+	for _, b := range a.Booked {
+		if b.Overlaps(p) {
+			return false
+		}
+	}
+
+	start := p.Start.In(Timezone)
+	end := p.End().In(Timezone)
+	day := start.Format("2006-01-02")
+	from, to := start.Format("15:04"), end.Format("15:04")
+	sameDay := end.Format("2006-01-02") == day || to == "00:00"
+	if to == "00:00" {
+		to = "24:00"
+	}
+
+	for _, e := range a.Exceptions {
+		if e.Date != day || e.Available {
+			continue
+		}
+		if !e.StartTime.Valid || e.StartTime.String < to && from < e.EndTime.String {
+			return false
+		}
+	}
+
+	for _, e := range a.Exceptions {
+		if e.Date != day || !e.Available {
+			continue
+		}
+		if !e.StartTime.Valid || sameDay && e.StartTime.String <= from && to <= e.EndTime.String {
+			return true
+		}
+	}
+
+	if !sameDay {
+		return false
+	}
+
+	for _, w := range a.Weekly {
+		if w.Weekday == start.Weekday() && w.StartTime <= from && to <= w.EndTime {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CoversAny of the periods, the tutor only needs to be free for one of the
+// proposed slots.
+func (a *Availability) CoversAny(periods []Period) bool {
+	for _, p := range periods {
+		if a.Covers(p) {
+			return true
+		}
+	}
+	return false
+}
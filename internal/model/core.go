@@ -1,9 +1,14 @@
 package model
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"sort"
+	"strings"
+	"time"
 	"upforschool/internal/pkg/worldline"
 
 	"github.com/disintegration/imaging"
@@ -129,12 +134,61 @@ func (c *Core) UpdateProfile(userID string, firstname, lastname, phone string, s
 				return fmt.Errorf("failed to add level: %w", err)
 			}
 		}
+
+		if err := updateSearchDocument(tx, tutorID); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
 	return tx.Commit()
 }
 
+// updateSearchDocument of the tutor for SearchTutors, whenever the alias,
+// bio, subjects, levels or locations change. Alias and subjects weigh the
+// most, then levels and locations, then the bio. migrations.sql backfills
+// existing tutors with the same document.
+func updateSearchDocument(tx *sql.Tx, tutorID string) error {
+	query := `
+	UPDATE tutors
+	   SET search_document = d.document
+	  FROM (
+	       SELECT t.id,
+	              setweight(to_tsvector('swedish', t.alias), 'A') ||
+	              setweight(to_tsvector('swedish', COALESCE(n.subjects, '')), 'A') ||
+	              setweight(to_tsvector('swedish', COALESCE(n.levels, '')), 'B') ||
+	              setweight(to_tsvector('swedish', n.locations), 'B') ||
+	              setweight(to_tsvector('swedish', COALESCE(t.description, '')), 'C') AS document
+	         FROM tutors AS t
+	        CROSS JOIN LATERAL (` + tutorSearchNames + `) AS n
+	        WHERE t.id = $1) AS d
+	 WHERE tutors.id = d.id`
+	if _, err := tx.Exec(query, tutorID); err != nil {
+		return fmt.Errorf("failed to update search document %w", err)
+	}
+	return nil
+}
+
+// ErrAliasReserved is returned for aliases that are routes under /tutors/,
+// the tutor's profile would never be shown.
+var ErrAliasReserved = errors.New("alias is reserved")
+
+// reservedAliases are the paths under /tutors/ that aren't profiles, and
+// "search" to keep it free for the directory.
+var reservedAliases = map[string]bool{
+	"list":   true,
+	"search": true,
+}
+
+// ReservedAlias reports whether alias can't be used as a tutor's alias.
+func ReservedAlias(alias string) bool {
+	return reservedAliases[strings.ToLower(strings.TrimSpace(alias))]
+}
+
 func (c *Core) AddTutor(tutor Tutor, locations []string, subjects []string, levels []string) (string, error) {
+	if ReservedAlias(tutor.Alias) {
+		return "", ErrAliasReserved
+	}
 
 	tx, err := c.db.Begin()
 	if err != nil {
@@ -184,36 +238,192 @@ func (c *Core) AddTutor(tutor Tutor, locations []string, subjects []string, leve
 		}
 	}
 
+	if err := updateSearchDocument(tx, id.String()); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
 	tx.Commit()
 	return id.String(), err
 
 }
 
 type LessonRequest struct {
-	SubjectID   string   `json:"subject"`
-	LevelID     string   `json:"level"`
-	LocationID  string   `json:"location"`
-	IsOnline    bool     `json:"isOnline"`
-	Tutors      []string `json:"tutors"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Duration    int      `json:"duration"` // minutes
+	SubjectID   string    `json:"subject"`
+	LevelID     string    `json:"level"`
+	LocationID  string    `json:"location"`
+	IsOnline    bool      `json:"isOnline"`
+	Tutors      []string  `json:"tutors"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartAt     time.Time `json:"startAt"`
+	Duration    int       `json:"duration"` // minutes
+
+	// Slots are alternative times and places, the tutor accepting picks one.
+	// Without slots the lesson has the single slot above.
+	Slots []LessonSlotRequest `json:"slots"`
+
+	// Recurrence repeats the lesson as a series, nil for a single lesson.
+	Recurrence *LessonRecurrence `json:"recurrence"`
+
+	// IsOpen puts the lesson on the board, where every tutor meeting its
+	// requirements can apply, besides the Tutors it's requested from.
+	IsOpen bool `json:"isOpen"`
+}
+
+// LessonSlotRequest is a proposed time and place for a lesson.
+type LessonSlotRequest struct {
+	StartAt    time.Time `json:"startAt"`
+	Duration   int       `json:"duration"` // minutes
+	LocationID string    `json:"location"`
+	IsOnline   bool      `json:"isOnline"`
+}
+
+// maxLessonSlots a student can propose for one lesson.
+const maxLessonSlots = 5
+
+// Lesson schedule errors.
+var (
+	ErrLessonStartInPast = errors.New("lesson must start in the future")
+	ErrLessonDuration    = errors.New("lesson duration must be between 15 minutes and 8 hours")
+	ErrLessonSlots       = errors.New("a lesson needs between 1 and 5 proposed times")
+	ErrSlotUnavailable   = errors.New("lesson slot is not open")
+)
+
+// Lesson request errors.
+var (
+	ErrDeclineReason     = errors.New("invalid decline reason")
+	ErrRequestNotPending = errors.New("lesson request is not pending for the tutor")
+	ErrLessonTaken       = errors.New("lesson has already been taken by another tutor")
+)
+
+// slots proposed in the request, validated and earliest first.
+func (r LessonRequest) slots() ([]LessonSlotRequest, error) {
+	slots := r.Slots
+	if len(slots) == 0 {
+		slots = []LessonSlotRequest{{StartAt: r.StartAt, Duration: r.Duration, LocationID: r.LocationID, IsOnline: r.IsOnline}}
+	}
+	if len(slots) > maxLessonSlots {
+		return nil, ErrLessonSlots
+	}
+
+	for i := range slots {
+		if slots[i].LocationID == "online" {
+			slots[i].LocationID = "-1"
+			slots[i].IsOnline = true
+		}
+		if err := validateSchedule(slots[i].StartAt, slots[i].Duration); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].StartAt.Before(slots[j].StartAt)
+	})
+	return slots, nil
 }
 
+// addLessonSlots proposed for lessonID.
+func addLessonSlots(tx *sql.Tx, lessonID string, slots []LessonSlotRequest) error {
+	query := `
+	INSERT INTO lesson_slots (lesson_id, start_at, duration, location_id, online_lesson)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	for _, slot := range slots {
+		if _, err := tx.Exec(query, lessonID, slot.StartAt, slot.Duration, slot.LocationID, slot.IsOnline); err != nil {
+			return fmt.Errorf("failed to add lesson slot %w", err)
+		}
+	}
+	return nil
+}
+
+// validateSchedule of a new or rescheduled lesson.
+func validateSchedule(startAt time.Time, duration int) error {
+	if !startAt.After(time.Now()) {
+		return ErrLessonStartInPast
+	}
+	if duration < 15 || duration > 8*60 {
+		return ErrLessonDuration
+	}
+	return nil
+}
+
+// AddLesson for the student userID and request it from the tutors. With a
+// Recurrence a series of lessons is added, one per occurrence, and the ID of
+// the first one is returned.
 func (c *Core) AddLesson(userID string, r LessonRequest) (string, error) {
 
 	if r.LocationID == "online" {
 		r.LocationID = "-1"
 	}
 
+	slots, err := r.slots()
+	if err != nil {
+		return "", err
+	}
+
+	occurrences := [][]LessonSlotRequest{slots}
+	if r.Recurrence != nil {
+		if len(slots) > 1 {
+			return "", ErrSeriesSlots
+		}
+
+		starts, err := r.Recurrence.occurrences(slots[0].StartAt)
+		if err != nil {
+			return "", err
+		}
+
+		occurrences = nil
+		for _, start := range starts {
+			slot := slots[0]
+			slot.StartAt = start
+			occurrences = append(occurrences, []LessonSlotRequest{slot})
+		}
+	}
+
 	log.Printf("%+v", r)
 	tx, err := c.db.Begin()
 	if err != nil {
 		return "", err
 	}
 
+	var seriesID sql.NullString
+	if r.Recurrence != nil {
+		seriesID, err = addLessonSeries(tx, userID, *r.Recurrence)
+		if err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	var first string
+	for i, occurrence := range occurrences {
+		id, err := addLesson(tx, userID, r, occurrence, seriesID)
+		if err != nil {
+			tx.Rollback()
+			return "", err
+		}
+		if i == 0 {
+			first = id
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	return first, nil
+}
+
+// addLesson with the proposed slots, part of seriesID if valid, and request
+// it from the tutors.
+func addLesson(tx *sql.Tx, userID string, r LessonRequest, slots []LessonSlotRequest, seriesID sql.NullString) (string, error) {
 	id := uuid.Must(uuid.NewV4())
 
+	// the lesson shows the earliest slot until a tutor picks one.
+	r.StartAt, r.Duration = slots[0].StartAt, slots[0].Duration
+
 	query := `
 	INSERT INTO lessons (
 		id,
@@ -223,35 +433,85 @@ func (c *Core) AddLesson(userID string, r LessonRequest) (string, error) {
 		location_id,
 		online_lesson,
 		title,
-		description
+		description,
+		start_at,
+		duration,
+		series_id,
+		is_open
 	)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err = tx.Exec(query, id, userID, r.SubjectID, r.LevelID, r.LocationID, r.IsOnline, r.Title, r.Description)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err := tx.Exec(query, id, userID, r.SubjectID, r.LevelID, r.LocationID, r.IsOnline, r.Title, r.Description, r.StartAt, r.Duration, seriesID, r.IsOpen)
 	if err != nil {
-		tx.Rollback()
 		return "", fmt.Errorf("failed to add lesson %w", err)
 	}
 
+	if err := addLessonSlots(tx, id.String(), slots); err != nil {
+		return "", err
+	}
+
+	if err := addLessonStatusChange(tx, id.String(), sql.NullString{}, LessonRequested, userID); err != nil {
+		return "", err
+	}
+
+	status, err := lessonRequestStatus(tx, id.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to check lesson payment %w", err)
+	}
+
+	if r.IsOpen && status == LessonRequestPending {
+		if err := publishLesson(tx, id.String()); err != nil {
+			return "", err
+		}
+	}
+
 	for _, tutorID := range r.Tutors {
 		query := `
 		INSERT INTO lesson_requests (lesson_id, tutor_id, status, created_at, updated_at)
-			 VALUES ($1, $2, 'PENDING', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
-		_, err = tx.Exec(query, id, tutorID)
+			 VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+		_, err = tx.Exec(query, id, tutorID, status)
 		if err != nil {
-			tx.Rollback()
 			return "", fmt.Errorf("failed to add lesson request %w", err)
 		}
 	}
 
-	err = tx.Commit()
-	if err != nil {
+	return id.String(), nil
+}
+
+// lessonRequestStatus for new lesson requests. Requests are held as
+// AWAITING_PAYMENT until the student has an active subscription or a
+// completed order for the lesson.
+func lessonRequestStatus(tx *sql.Tx, lessonID string) (string, error) {
+	query := `
+	SELECT EXISTS (
+	         SELECT 1
+	           FROM subscriptions AS s
+	           JOIN lessons AS l ON l.student_id = s.user_id
+	          WHERE l.id = $1
+	            AND s.activated_at IS NOT NULL
+	            AND s.ends_at > CURRENT_TIMESTAMP)
+	    OR EXISTS (
+	         SELECT 1
+	           FROM orders AS o
+	          WHERE o.lesson_id = $1
+	            AND o.status = 'COMPLETED')`
+
+	var paid bool
+	if err := tx.QueryRow(query, lessonID).Scan(&paid); err != nil {
 		return "", err
 	}
 
-	return id.String(), nil
+	if paid {
+		return LessonRequestPending, nil
+	}
+	return LessonRequestAwaitingPayment, nil
 }
 
-func (c *Core) UpdateLesson(lessonID string, r LessonRequest) error {
+// UpdateLesson changes the lesson's text and schedule and requests the lesson
+// from more tutors. A zero StartAt or Duration keeps the current schedule.
+// Rescheduled reports whether the start or duration changed, the tutors
+// already requested should then be told. Returns ErrTutorBusy if the tutor
+// who accepted the lesson has another lesson at the new time.
+func (c *Core) UpdateLesson(lessonID string, r LessonRequest) (rescheduled bool, err error) {
 
 	if r.LocationID == "online" {
 		r.LocationID = "-1"
@@ -259,21 +519,82 @@ func (c *Core) UpdateLesson(lessonID string, r LessonRequest) error {
 
 	tx, err := c.db.Begin()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	query := `
+	// lock the tutor before the lesson, like acceptLesson, so the busy check
+	// below can't race with the tutor accepting another lesson.
+	var tutorID sql.NullString
+	if err := tx.QueryRow("SELECT tutor_id FROM lessons WHERE id = $1", lessonID).Scan(&tutorID); err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to fetch lesson %w", err)
+	}
+	if tutorID.Valid {
+		if _, err := tx.Exec("SELECT 1 FROM tutors WHERE id = $1 FOR UPDATE", tutorID.String); err != nil {
+			tx.Rollback()
+			return false, fmt.Errorf("failed to lock tutor %w", err)
+		}
+	}
+
+	var startAt time.Time
+	var duration int
+	var lessonStatus string
+	query := `SELECT start_at, duration, status, tutor_id FROM lessons WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(query, lessonID).Scan(&startAt, &duration, &lessonStatus, &tutorID); err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to fetch lesson %w", err)
+	}
+
+	if r.StartAt.IsZero() {
+		r.StartAt = startAt
+	}
+	if r.Duration == 0 {
+		r.Duration = duration
+	}
+
+	rescheduled = !r.StartAt.Equal(startAt) || r.Duration != duration
+	if rescheduled {
+		if err := validateSchedule(r.StartAt, r.Duration); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	// the tutor who accepted the lesson must be free at the new time.
+	if rescheduled && tutorID.Valid && (lessonStatus == LessonAccepted || lessonStatus == LessonScheduled) {
+		busy, err := tutorBusy(tx, tutorID.String, lessonID, r.StartAt, r.Duration)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if busy {
+			tx.Rollback()
+			return false, ErrTutorBusy
+		}
+	}
+
+	query = `
 	UPDATE lessons
 	SET 
 	    title = $2,
 	    description = $3,
+	    start_at = $4,
+	    duration = $5,
+	    sequence = sequence + CASE WHEN $6 THEN 1 ELSE 0 END,
 	    updated_at = CURRENT_TIMESTAMP
 	WHERE id = $1`
 
-	_, err = tx.Exec(query, lessonID, r.Title, r.Description)
+	_, err = tx.Exec(query, lessonID, r.Title, r.Description, r.StartAt, r.Duration, rescheduled)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to update lesson %w", err)
+		return false, fmt.Errorf("failed to update lesson %w", err)
+	}
+
+	if rescheduled {
+		if err := rescheduleSlots(tx, lessonID, r.StartAt, r.Duration); err != nil {
+			tx.Rollback()
+			return false, err
+		}
 	}
 
 	// Delete existing lesson requests
@@ -283,66 +604,296 @@ func (c *Core) UpdateLesson(lessonID string, r LessonRequest) error {
 	// 	return fmt.Errorf("failed to delete old lesson requests %w", err)
 	// }
 
+	status, err := lessonRequestStatus(tx, lessonID)
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to check lesson payment %w", err)
+	}
+
 	// Add new lesson requests
 	for _, tutorID := range r.Tutors {
 		log.Println("adding lesson request for tutor:", lessonID, tutorID)
 		query := `
 		INSERT INTO lesson_requests (lesson_id, tutor_id, status, created_at, updated_at)
-			 VALUES ($1, $2, 'PENDING', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
-		_, err = tx.Exec(query, lessonID, tutorID)
+			 VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+		_, err = tx.Exec(query, lessonID, tutorID, status)
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to add lesson request %w", err)
+			return false, fmt.Errorf("failed to add lesson request %w", err)
 		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	return rescheduled, nil
+}
+
+// rescheduleSlots moves the accepted slot of the lesson to startAt. If no
+// tutor has accepted yet the proposed slots are released and replaced with a
+// single one at the lesson's location.
+func rescheduleSlots(tx *sql.Tx, lessonID string, startAt time.Time, duration int) error {
+	query := `
+	UPDATE lesson_slots AS s
+	   SET start_at = $2,
+	       duration = $3
+	  FROM lesson_requests AS lr
+	 WHERE lr.slot_id = s.id
+	   AND lr.lesson_id = $1
+	   AND lr.status = 'ACCEPTED'`
+	res, err := tx.Exec(query, lessonID, startAt, duration)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule lesson slot %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	query = `
+	UPDATE lesson_slots
+	   SET released_at = CURRENT_TIMESTAMP
+	 WHERE lesson_id = $1
+	   AND released_at IS NULL`
+	if _, err := tx.Exec(query, lessonID); err != nil {
+		return fmt.Errorf("failed to release lesson slots %w", err)
+	}
+
+	query = `
+	INSERT INTO lesson_slots (lesson_id, start_at, duration, location_id, online_lesson)
+	SELECT id, $2, $3, location_id, online_lesson
+	  FROM lessons
+	 WHERE id = $1`
+	if _, err := tx.Exec(query, lessonID, startAt, duration); err != nil {
+		return fmt.Errorf("failed to add lesson slot %w", err)
 	}
 
 	return nil
 }
 
-func (c *Core) AcceptLesson(lessonID, tutorID string) (string, error) {
+// AcceptLesson for tutorID at the proposed slotID. The lesson takes the
+// slot's time and place and the other proposed slots are released. Returns
+// ErrTutorBusy if the tutor has accepted another lesson at that time and
+// ErrLessonTaken if another tutor accepted the lesson first.
+func (c *Core) AcceptLesson(lessonID, tutorID string, slotID int64) (string, error) {
 
 	tx, err := c.db.Begin()
 	if err != nil {
 		return "", err
 	}
 
-	query := `
+	if err := acceptLesson(tx, lessonID, tutorID, slotID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	return lessonID, nil
+}
+
+// acceptLesson for the tutor in tx. The first tutor to accept wins: the
+// lesson is locked and later tutors get ErrLessonTaken, and the other
+// pending requests are CLOSED. The tutor is locked before the lesson so
+// acceptances of a whole series can't deadlock with single ones.
+func acceptLesson(tx *sql.Tx, lessonID, tutorID string, slotID int64) error {
+	// serialize acceptances per tutor so two lessons at the same time can't
+	// both be accepted.
+	var tutorUserID string
+	if err := tx.QueryRow("SELECT user_id FROM tutors WHERE id = $1 FOR UPDATE", tutorID).Scan(&tutorUserID); err != nil {
+		return fmt.Errorf("failed to lock tutor %w", err)
+	}
+
+	var current sql.NullString
+	if err := tx.QueryRow("SELECT tutor_id FROM lessons WHERE id = $1 FOR UPDATE", lessonID).Scan(&current); err != nil {
+		return fmt.Errorf("failed to lock lesson %w", err)
+	}
+	if current.Valid {
+		return ErrLessonTaken
+	}
+
+	var requestStatus string
+	query := `SELECT status FROM lesson_requests WHERE lesson_id = $1 AND tutor_id = $2`
+	err := tx.QueryRow(query, lessonID, tutorID).Scan(&requestStatus)
+	if err == sql.ErrNoRows {
+		return ErrRequestNotPending
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch lesson request %w", err)
+	}
+	if requestStatus == LessonRequestClosed {
+		return ErrLessonTaken
+	}
+	if requestStatus != LessonRequestPending {
+		return ErrRequestNotPending
+	}
+
+	var slot LessonSlotRequest
+	query = `
+	SELECT start_at, duration, location_id, online_lesson
+	  FROM lesson_slots
+	 WHERE id = $1
+	   AND lesson_id = $2
+	   AND released_at IS NULL`
+	err = tx.QueryRow(query, slotID, lessonID).Scan(&slot.StartAt, &slot.Duration, &slot.LocationID, &slot.IsOnline)
+	if err == sql.ErrNoRows {
+		return ErrSlotUnavailable
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch lesson slot %w", err)
+	}
+
+	busy, err := tutorBusy(tx, tutorID, lessonID, slot.StartAt, slot.Duration)
+	if err != nil {
+		return err
+	}
+	if busy {
+		return ErrTutorBusy
+	}
+
+	// conditional on the lesson still being open, in case it's ever updated
+	// without the lock above.
+	res, err := tx.Exec(`UPDATE lessons
+	   SET tutor_id = $1,
+	       start_at = $3,
+	       duration = $4,
+	       location_id = $5,
+	       online_lesson = $6,
+	       sequence = sequence + 1,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $2
+	   AND tutor_id IS NULL`, tutorID, lessonID, slot.StartAt, slot.Duration, slot.LocationID, slot.IsOnline)
+	if err != nil {
+		return fmt.Errorf("failed to update lesson %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLessonTaken
+	}
+
+	if err := transitionLesson(tx, lessonID, LessonAccepted, tutorUserID); err != nil {
+		return err
+	}
+
+	query = `
 	UPDATE lesson_requests
 	   SET status = 'ACCEPTED',
+	       slot_id = $3,
 	       updated_at = CURRENT_TIMESTAMP,
 		   accepted_at = CURRENT_TIMESTAMP
 	 WHERE lesson_id = $1 AND tutor_id = $2`
-	_, err = tx.Exec(query, lessonID, tutorID)
+	_, err = tx.Exec(query, lessonID, tutorID, slotID)
 	if err != nil {
-		tx.Rollback()
-		return "", fmt.Errorf("failed to accept lesson %w", err)
+		return fmt.Errorf("failed to accept lesson %w", err)
 	}
 
-	_, err = tx.Exec(`UPDATE lessons
-	   SET tutor_id = $1,
+	query = `
+	UPDATE lesson_requests
+	   SET status = 'CLOSED',
 	       updated_at = CURRENT_TIMESTAMP
-	 WHERE id = $2`, tutorID, lessonID)
+	 WHERE lesson_id = $1
+	   AND tutor_id <> $2
+	   AND status IN ('PENDING', 'AWAITING_PAYMENT', 'APPLIED')`
+	if _, err := tx.Exec(query, lessonID, tutorID); err != nil {
+		return fmt.Errorf("failed to close lesson requests %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE lesson_slots
+	   SET released_at = CURRENT_TIMESTAMP
+	 WHERE lesson_id = $1
+	   AND id <> $2
+	   AND released_at IS NULL`, lessonID, slotID)
 	if err != nil {
-		tx.Rollback()
-		return "", fmt.Errorf("failed to update lesson %w", err)
+		return fmt.Errorf("failed to release lesson slots %w", err)
 	}
 
-	err = tx.Commit()
+	return scheduleIfPaid(tx, lessonID)
+}
+
+// tutorBusy reports whether the tutor has another lesson than lessonID
+// overlapping startAt for duration minutes. Lock the tutor first.
+func tutorBusy(tx *sql.Tx, tutorID, lessonID string, startAt time.Time, duration int) (bool, error) {
+	var busy bool
+	query := `
+	SELECT EXISTS (
+	         SELECT 1
+	           FROM lessons
+	          WHERE tutor_id = $1
+	            AND id <> $2
+	            AND deleted_at IS NULL
+	            AND start_at < $3::timestamptz + $4 * INTERVAL '1 minute'
+	            AND start_at + duration * INTERVAL '1 minute' > $3)`
+	if err := tx.QueryRow(query, tutorID, lessonID, startAt, duration).Scan(&busy); err != nil {
+		return false, fmt.Errorf("failed to check tutor lessons %w", err)
+	}
+	return busy, nil
+}
+
+// DeclineLesson request for tutorID with reason, one of the DeclineReason
+// constants, and an optional message. Returns allDeclined if every tutor the
+// lesson was requested from has now declined.
+func (c *Core) DeclineLesson(lessonID, tutorID, reason, message string) (allDeclined bool, err error) {
+	switch reason {
+	case DeclineReasonBusy, DeclineReasonSubject, DeclineReasonLocation, DeclineReasonOther:
+	default:
+		return false, ErrDeclineReason
+	}
+
+	tx, err := c.db.Begin()
 	if err != nil {
-		return "", err
+		return false, err
 	}
 
-	return lessonID, nil
+	query := `
+	UPDATE lesson_requests
+	   SET status = 'DECLINED',
+	       decline_reason = $3,
+	       decline_message = NULLIF($4, ''),
+	       declined_at = CURRENT_TIMESTAMP,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE lesson_id = $1
+	   AND tutor_id = $2
+	   AND status = 'PENDING'`
+	res, err := tx.Exec(query, lessonID, tutorID, reason, strings.TrimSpace(message))
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to decline lesson %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return false, ErrRequestNotPending
+	}
+
+	query = `
+	SELECT NOT EXISTS (
+	         SELECT 1
+	           FROM lesson_requests
+	          WHERE lesson_id = $1
+	            AND status != 'DECLINED')`
+	if err := tx.QueryRow(query, lessonID).Scan(&allDeclined); err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to check lesson requests %w", err)
+	}
+
+	return allDeclined, tx.Commit()
 }
 
-func (c *Core) DeleteLesson(lessonID string) error {
-	_, err := c.db.Exec("UPDATE lessons set deleted_at = NOW() where id = $1", lessonID)
-	return err
+// DeleteLesson cancels the lesson for the student userID.
+func (c *Core) DeleteLesson(lessonID, userID string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := transitionLesson(tx, lessonID, LessonCancelledByStudent, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // SwitchOrganization use cae.
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Availability errors.
+var (
+	ErrAvailabilityTime = errors.New("availability must have a valid date and end after it starts")
+	ErrTutorBusy        = errors.New("tutor already has a lesson at that time")
+)
+
+// parseTimeRange of "15:04" times, start before end.
+func parseTimeRange(startTime, endTime string) error {
+	start, err := time.Parse("15:04", startTime)
+	if err != nil {
+		return ErrAvailabilityTime
+	}
+	end, err := time.Parse("15:04", endTime)
+	if err != nil || !end.After(start) {
+		return ErrAvailabilityTime
+	}
+	return nil
+}
+
+// AddAvailability of the tutor every weekday between startTime and endTime,
+// "15:04" in Timezone.
+func (c *Core) AddAvailability(tutorID string, weekday time.Weekday, startTime, endTime string) error {
+	if weekday < time.Sunday || weekday > time.Saturday {
+		return ErrAvailabilityTime
+	}
+	if err := parseTimeRange(startTime, endTime); err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO tutor_availability (tutor_id, weekday, start_time, end_time)
+	VALUES ($1, $2, $3, $4)`
+	if _, err := c.db.Exec(query, tutorID, weekday, startTime, endTime); err != nil {
+		return fmt.Errorf("failed to add availability %w", err)
+	}
+	return nil
+}
+
+// DeleteAvailability of the tutor by ID.
+func (c *Core) DeleteAvailability(tutorID string, id int64) error {
+	_, err := c.db.Exec("DELETE FROM tutor_availability WHERE id = $1 AND tutor_id = $2", id, tutorID)
+	return err
+}
+
+// AddAvailabilityException on date, "2006-01-02". Empty times cover the whole
+// day. Available adds free time, otherwise the time is blocked.
+func (c *Core) AddAvailabilityException(tutorID, date, startTime, endTime string, available bool) error {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return ErrAvailabilityTime
+	}
+
+	var start, end any
+	if startTime != "" || endTime != "" {
+		if err := parseTimeRange(startTime, endTime); err != nil {
+			return err
+		}
+		start, end = startTime, endTime
+	}
+
+	query := `
+	INSERT INTO tutor_availability_exceptions (tutor_id, date, start_time, end_time, available)
+	VALUES ($1, $2, $3, $4, $5)`
+	if _, err := c.db.Exec(query, tutorID, date, start, end, available); err != nil {
+		return fmt.Errorf("failed to add availability exception %w", err)
+	}
+	return nil
+}
+
+// DeleteAvailabilityException of the tutor by ID.
+func (c *Core) DeleteAvailabilityException(tutorID string, id int64) error {
+	_, err := c.db.Exec("DELETE FROM tutor_availability_exceptions WHERE id = $1 AND tutor_id = $2", id, tutorID)
+	return err
+}
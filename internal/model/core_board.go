@@ -0,0 +1,179 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Lesson board errors.
+var (
+	ErrLessonNotOpen  = errors.New("lesson is not open for applications")
+	ErrAlreadyApplied = errors.New("tutor has already applied or been asked")
+)
+
+// maxApplicationMessage in characters.
+const maxApplicationMessage = 1000
+
+// publishLesson on the board.
+func publishLesson(tx *sql.Tx, lessonID string) error {
+	query := `
+	UPDATE lessons
+	   SET published_at = CURRENT_TIMESTAMP,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $1
+	   AND is_open
+	   AND published_at IS NULL`
+	if _, err := tx.Exec(query, lessonID); err != nil {
+		return fmt.Errorf("failed to publish lesson %w", err)
+	}
+	return nil
+}
+
+// publishOpenLessons of the student that have been paid for, after a payment.
+func publishOpenLessons(tx *sql.Tx, studentID string) error {
+	query := `
+	SELECT id
+	  FROM lessons
+	 WHERE student_id = $1
+	   AND is_open
+	   AND published_at IS NULL
+	   AND deleted_at IS NULL`
+	rows, err := tx.Query(query, studentID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch open lessons %w", err)
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		status, err := lessonRequestStatus(tx, id)
+		if err != nil {
+			return err
+		}
+		if status != LessonRequestPending {
+			continue
+		}
+		if err := publishLesson(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyForLesson on the board for tutorID at the proposed slotID, with a
+// short message to the student. Whether the tutor meets the lesson's
+// requirements is checked by the caller.
+func (c *Core) ApplyForLesson(lessonID, tutorID string, slotID int64, message string) error {
+	message = strings.TrimSpace(message)
+	if len([]rune(message)) > maxApplicationMessage {
+		message = string([]rune(message)[:maxApplicationMessage])
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var open bool
+	query := `
+	SELECT is_open AND published_at IS NOT NULL AND status = 'REQUESTED' AND start_at > CURRENT_TIMESTAMP
+	  FROM lessons
+	 WHERE id = $1
+	   FOR UPDATE`
+	err = tx.QueryRow(query, lessonID).Scan(&open)
+	if err == sql.ErrNoRows || err == nil && !open {
+		tx.Rollback()
+		return ErrLessonNotOpen
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch lesson %w", err)
+	}
+
+	var slotOpen bool
+	query = `SELECT EXISTS (SELECT 1 FROM lesson_slots WHERE id = $1 AND lesson_id = $2 AND released_at IS NULL)`
+	if err := tx.QueryRow(query, slotID, lessonID).Scan(&slotOpen); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch lesson slot %w", err)
+	}
+	if !slotOpen {
+		tx.Rollback()
+		return ErrSlotUnavailable
+	}
+
+	query = `
+	INSERT INTO lesson_requests (lesson_id, tutor_id, slot_id, status, message)
+	VALUES ($1, $2, $3, 'APPLIED', NULLIF($4, ''))
+	ON CONFLICT (lesson_id, tutor_id) DO NOTHING`
+	res, err := tx.Exec(query, lessonID, tutorID, slotID, message)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to apply for lesson %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrAlreadyApplied
+	}
+
+	return tx.Commit()
+}
+
+// ChooseApplicant of the student's open lesson. The tutor's application is
+// accepted at the slot the tutor applied for, as if the tutor accepted it.
+func (c *Core) ChooseApplicant(lessonID, studentID, tutorID string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var slotID int64
+	query := `
+	SELECT lr.slot_id
+	  FROM lesson_requests AS lr
+	  JOIN lessons AS l ON l.id = lr.lesson_id
+	 WHERE lr.lesson_id = $1
+	   AND lr.tutor_id = $2
+	   AND lr.status = 'APPLIED'
+	   AND l.student_id = $3`
+	err = tx.QueryRow(query, lessonID, tutorID, studentID).Scan(&slotID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrRequestNotPending
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch application %w", err)
+	}
+
+	query = `
+	UPDATE lesson_requests
+	   SET status = 'PENDING',
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE lesson_id = $1
+	   AND tutor_id = $2`
+	if _, err := tx.Exec(query, lessonID, tutorID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to choose applicant %w", err)
+	}
+
+	if err := acceptLesson(tx, lessonID, tutorID, slotID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
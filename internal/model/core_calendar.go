@@ -0,0 +1,62 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// newCalendarToken for a calendar feed URL, hard to guess.
+func newCalendarToken() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CalendarToken of the user, created the first time it's asked for. Later
+// calls only read it.
+func (c *Core) CalendarToken(userID string) (string, error) {
+	var current sql.NullString
+	if err := c.db.Get(&current, "SELECT calendar_token FROM users WHERE id = $1", userID); err != nil {
+		return "", fmt.Errorf("failed to fetch calendar token %w", err)
+	}
+	if current.Valid {
+		return current.String, nil
+	}
+
+	token, err := newCalendarToken()
+	if err != nil {
+		return "", err
+	}
+
+	// a concurrent call may have set the token since it was read.
+	query := `
+	UPDATE users
+	   SET calendar_token = $2
+	 WHERE id = $1
+	   AND calendar_token IS NULL`
+	if _, err := c.db.Exec(query, userID, token); err != nil {
+		return "", fmt.Errorf("failed to add calendar token %w", err)
+	}
+
+	if err := c.db.Get(&token, "SELECT calendar_token FROM users WHERE id = $1", userID); err != nil {
+		return "", fmt.Errorf("failed to fetch calendar token %w", err)
+	}
+	return token, nil
+}
+
+// ResetCalendarToken of the user, the old feed URL stops working.
+func (c *Core) ResetCalendarToken(userID string) error {
+	token, err := newCalendarToken()
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.db.Exec("UPDATE users SET calendar_token = $2 WHERE id = $1", userID, token); err != nil {
+		return fmt.Errorf("failed to reset calendar token %w", err)
+	}
+	return nil
+}
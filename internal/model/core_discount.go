@@ -0,0 +1,264 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Discount errors.
+var (
+	ErrDiscountNotFound = errors.New("discount code not found")
+	ErrDiscountExpired  = errors.New("expired discount code")
+	ErrDiscountCurrency = errors.New("discount code not applicable to currency")
+)
+
+type discount struct {
+	ID         int64   `db:"id"`
+	Code       string  `db:"code"`
+	Amount     int64   `db:"amount"`
+	IsCampaign bool    `db:"is_campaign"`
+	IsPercent  bool    `db:"is_percent"`
+	Currency   *string `db:"currency"`
+	IsValid    bool    `db:"is_valid"`
+	IsUsed     bool    `db:"is_used"`
+}
+
+func (d *discount) Usable() bool {
+	if !d.IsValid {
+		return false
+	}
+
+	if d.IsCampaign {
+		return true
+	}
+
+	return !d.IsUsed
+}
+
+// Discount off price, never more than the price. Percent discounts round
+// half away from zero to the nearest minor unit, fixed amounts (in minor
+// units) only apply in their own currency.
+func (d *discount) Discount(price Money) (Money, error) {
+	if d.IsPercent {
+		return price.Percent(min(d.Amount, 100)), nil
+	}
+
+	if d.Currency == nil || *d.Currency != price.Currency {
+		return Money{}, ErrDiscountCurrency
+	}
+
+	return Money{min(d.Amount, price.Amount), price.Currency}, nil
+}
+
+// lockDiscountByCode locks the discount row for the rest of tx, so two
+// concurrent checkouts can't both redeem a single-use code. The code counts as
+// used if any other order or subscription than orderID/subscriptionID has
+// paid with it or holds it: created or pending and touched within the last
+// hour, the lifetime of a worldline checkout session. Failed and abandoned
+// checkouts don't use it up.
+func lockDiscountByCode(tx *sqlx.Tx, code string, orderID, subscriptionID int64) (*discount, error) {
+	var id int64
+	err := tx.Get(&id, "SELECT id FROM discounts WHERE code = $1 FOR UPDATE", code)
+	if err == sql.ErrNoRows {
+		return nil, ErrDiscountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT d.id AS id,
+           d.code AS code,
+           d.amount AS amount,
+           d.campaign AS is_campaign,
+		   d.is_percent AS is_percent,
+		   d.currency AS currency,
+           d.valid_to >= CURRENT_TIMESTAMP AS is_valid,
+           (EXISTS (SELECT 1 FROM orders AS o
+                     WHERE o.discount_id = d.id AND o.id != $2
+                       AND (o.status = 'COMPLETED'
+                            OR o.status IN ('CREATED', 'PENDING') AND o.updated_at > CURRENT_TIMESTAMP - interval '1 hour'))
+            OR EXISTS (SELECT 1 FROM subscriptions AS s
+                        WHERE s.discount_id = d.id AND s.id != $3
+                          AND (s.status = 'COMPLETED'
+                               OR s.status IN ('CREATED', 'PENDING') AND s.updated_at > CURRENT_TIMESTAMP - interval '1 hour'))) AS is_used
+      FROM discounts AS d
+     WHERE d.id = $1`
+
+	var d discount
+	if err := tx.Get(&d, query, id, orderID, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	if !d.Usable() {
+		return nil, ErrDiscountExpired
+	}
+
+	return &d, nil
+}
+
+type productInfo struct {
+	ProductCost int64  `db:"product_cost"`
+	ProductTax  int64  `db:"product_tax"`
+	Currency    string `db:"currency"`
+}
+
+func (p *productInfo) Price() Money {
+	return Money{p.ProductCost, p.Currency}
+}
+
+func productInfoByOrderID(tx *sqlx.Tx, orderID int64) (*productInfo, error) {
+	query := `
+	SELECT o.product_cost,
+	       o.product_tax,
+		   o.currency as currency
+      FROM orders AS o
+     WHERE o.id = $1
+       FOR UPDATE`
+
+	var p productInfo
+	return &p, tx.Get(&p, query, orderID)
+}
+
+// orderDiscountChangeable is true for orders without an open worldline
+// checkout session for the current amount: created, failed, or pending with
+// the last session started more than an hour ago.
+const orderDiscountChangeable = `
+	(status IN ('CREATED', 'FAILED')
+	 OR status = 'PENDING' AND updated_at <= CURRENT_TIMESTAMP - interval '1 hour')`
+
+// holdOrderDiscount re-checks the order's discount code before a payment is
+// started, as it may have been redeemed elsewhere since the order's hold ran
+// out, and holds it for another hour.
+func (c *Core) holdOrderDiscount(orderID int64) error {
+	var code sql.NullString
+	query := `
+	SELECT d.code
+	  FROM orders AS o
+	  LEFT JOIN discounts AS d ON d.id = o.discount_id
+	 WHERE o.id = $1`
+	if err := c.db.Get(&code, query, orderID); err != nil {
+		return err
+	}
+	if !code.Valid {
+		return nil
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := lockDiscountByCode(tx, code.String, orderID, 0); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET updated_at = CURRENT_TIMESTAMP WHERE id = $1", orderID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to hold discount %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// AddDiscountToOrder validates code and records it on the order together with
+// the recalculated cost. Returns ErrPaymentTransition while a checkout session
+// for the order is open.
+func (c *Core) AddDiscountToOrder(orderID int64, code string) (*Cost, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := lockDiscountByCode(tx, code, orderID, 0)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	product, err := productInfoByOrderID(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	discount, err := d.Discount(product.Price())
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	cost := calculateCost(product.Price(), product.ProductTax, discount)
+
+	query := `
+	UPDATE orders
+	  SET discount_id = $1,
+          amount = $3,
+          tax_amount = $4,
+		  discount_amount = $5,
+		  updated_at = CURRENT_TIMESTAMP
+    WHERE id = $2
+	  AND ` + orderDiscountChangeable
+	res, err := tx.Exec(query, d.ID, orderID,
+		cost.Total.Amount,
+		cost.Tax.Amount,
+		cost.Discount.Amount)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to add discount %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: discount on order %d", ErrPaymentTransition, orderID)
+	}
+
+	return &cost, tx.Commit()
+}
+
+// RemoveDiscountFromOrder and restore the full cost. Returns
+// ErrPaymentTransition while a checkout session for the order is open.
+func (c *Core) RemoveDiscountFromOrder(orderID int64) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	p, err := productInfoByOrderID(tx, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	cost := calculateCost(p.Price(), p.ProductTax, Money{0, p.Currency})
+
+	query := `
+    UPDATE orders
+       SET discount_id = NULL,
+           amount = $2,
+           tax_amount = $3,
+           discount_amount = 0,
+           updated_at = CURRENT_TIMESTAMP
+     WHERE id = $1
+       AND ` + orderDiscountChangeable
+
+	res, err := tx.Exec(query, orderID, cost.Total.Amount, cost.Tax.Amount)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to remove discount %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: discount on order %d", ErrPaymentTransition, orderID)
+	}
+
+	return tx.Commit()
+}
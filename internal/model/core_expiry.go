@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ExpireLessonRequests marks requests EXPIRED that no tutor has answered
+// within age, and every unanswered request or application for a lesson that
+// has already started. Returns the lessons still waiting for a tutor that
+// have no open requests left, so the student can be told to ask others.
+func (c *Core) ExpireLessonRequests(age time.Duration) ([]string, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	UPDATE lesson_requests AS lr
+	   SET status = 'EXPIRED',
+	       updated_at = CURRENT_TIMESTAMP
+	  FROM lessons AS l
+	 WHERE lr.lesson_id = l.id
+	   AND l.status = 'REQUESTED'
+	   AND (lr.status = 'PENDING' AND lr.updated_at <= CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+	        OR lr.status IN ('PENDING', 'AWAITING_PAYMENT', 'APPLIED') AND l.start_at <= CURRENT_TIMESTAMP)
+	RETURNING lr.lesson_id`
+	rows, err := tx.Query(query, int64(age/time.Second))
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to expire lesson requests %w", err)
+	}
+
+	seen := map[string]bool{}
+	var expired []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var result []string
+	if len(expired) > 0 {
+		query = `
+		SELECT l.id
+		  FROM lessons AS l
+		 WHERE l.id = ANY($1)
+		   AND l.deleted_at IS NULL
+		   AND NOT EXISTS (
+		       SELECT 1
+		         FROM lesson_requests AS lr
+		        WHERE lr.lesson_id = l.id
+		          AND lr.status IN ('PENDING', 'AWAITING_PAYMENT', 'APPLIED', 'ACCEPTED'))`
+		rows, err := tx.Query(query, pq.Array(expired))
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to fetch expired lessons %w", err)
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return nil, err
+			}
+			result = append(result, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// ArchiveLessons that have been over for longer than age: cancelled, held,
+// missed or never accepted before they were to start. Archived lessons are
+// hidden from the lesson lists.
+func (c *Core) ArchiveLessons(age time.Duration) (int64, error) {
+	query := `
+	UPDATE lessons
+	   SET archived_at = CURRENT_TIMESTAMP
+	 WHERE archived_at IS NULL
+	   AND (deleted_at <= CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+	        OR status IN ('COMPLETED', 'NO_SHOW', 'REQUESTED')
+	           AND start_at + duration * INTERVAL '1 minute' <= CURRENT_TIMESTAMP - $1 * INTERVAL '1 second')`
+	res, err := c.db.Exec(query, int64(age/time.Second))
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive lessons %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CommissionPercent the platform keeps of a paid lesson.
+const CommissionPercent = 20
+
+// Ledger transaction kinds.
+const (
+	LedgerLesson = "LESSON"
+	LedgerPayout = "PAYOUT"
+)
+
+// Ledger accounts. Entries are debits when positive and credits when
+// negative.
+const (
+	// LedgerAccountPayments holds what students have paid for lessons.
+	LedgerAccountPayments = "PAYMENTS"
+	// LedgerAccountCommission is the platform's share of paid lessons.
+	LedgerAccountCommission = "COMMISSION"
+	// LedgerAccountTutor is what the platform owes a tutor.
+	LedgerAccountTutor = "TUTOR_PAYABLE"
+	// LedgerAccountPayouts is money paid out to tutors.
+	LedgerAccountPayouts = "PAYOUTS"
+)
+
+// Ledger errors.
+var (
+	ErrLessonNotCompletable = errors.New("lesson is not accepted by tutor or already completed")
+	ErrPayoutBalance        = errors.New("payout exceeds tutor balance")
+	ErrLedgerUnbalanced     = errors.New("ledger entries do not balance")
+)
+
+type ledgerEntry struct {
+	Account string
+	TutorID sql.NullString
+	Amount  Money
+}
+
+// addLedgerTransaction with entries that must sum to zero.
+func addLedgerTransaction(tx *sqlx.Tx, kind string, lessonID sql.NullString, tutorID, reference string, entries []ledgerEntry) error {
+	var sum int64
+	for _, e := range entries {
+		sum += e.Amount.Amount
+	}
+	if sum != 0 {
+		return ErrLedgerUnbalanced
+	}
+
+	query := `
+	INSERT INTO ledger_transactions (kind, lesson_id, tutor_id, reference)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id`
+
+	var id int64
+	if err := tx.Get(&id, query, kind, lessonID, tutorID, reference); err != nil {
+		return fmt.Errorf("failed to add ledger transaction %w", err)
+	}
+
+	query = `
+	INSERT INTO ledger_entries (transaction_id, account, tutor_id, amount, currency)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	for _, e := range entries {
+		if _, err := tx.Exec(query, id, e.Account, e.TutorID, e.Amount.Amount, e.Amount.Currency); err != nil {
+			return fmt.Errorf("failed to add ledger entry %w", err)
+		}
+	}
+
+	return nil
+}
+
+// CompleteLesson marks the lesson accepted by tutorID as held, for the tutor's
+// user userID. If the student
+// paid for the lesson the tutor is credited the payment less the platform's
+// CommissionPercent. Lessons covered by a subscription have no payment to
+// share and only get marked as completed.
+func (c *Core) CompleteLesson(lessonID, tutorID, userID string) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	err = lessonTutorTransition(tx.Tx, lessonID, tutorID, userID, LessonCompleted)
+	if errors.Is(err, ErrLessonTransition) || errors.Is(err, ErrNotLessonTutor) {
+		tx.Rollback()
+		return ErrLessonNotCompletable
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var paid Money
+	query := `
+	SELECT amount, currency
+	  FROM orders
+	 WHERE lesson_id = $1
+	   AND status = 'COMPLETED'
+	   AND amount > 0
+	   FOR SHARE`
+	err = tx.Get(&paid, query, lessonID)
+	if err == sql.ErrNoRows {
+		return tx.Commit()
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	commission := paid.Percent(CommissionPercent)
+	tutor := sql.NullString{String: tutorID, Valid: true}
+
+	err = addLedgerTransaction(tx, LedgerLesson, sql.NullString{String: lessonID, Valid: true}, tutorID, "", []ledgerEntry{
+		{Account: LedgerAccountPayments, Amount: paid},
+		{Account: LedgerAccountCommission, Amount: Money{-commission.Amount, paid.Currency}},
+		{Account: LedgerAccountTutor, TutorID: tutor, Amount: Money{-(paid.Amount - commission.Amount), paid.Currency}},
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddPayout records amount paid out to the tutor, e.g. a bank transfer with
+// reference. The payout can't exceed what the tutor is owed.
+func (c *Core) AddPayout(tutorID string, amount Money, reference string) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	// serialize payouts per tutor.
+	var id string
+	if err := tx.Get(&id, "SELECT id FROM tutors WHERE id = $1 FOR UPDATE", tutorID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var balance int64
+	query := `
+	SELECT COALESCE(-SUM(amount), 0)
+	  FROM ledger_entries
+	 WHERE tutor_id = $1
+	   AND account = $2
+	   AND currency = $3`
+	if err := tx.Get(&balance, query, tutorID, LedgerAccountTutor, amount.Currency); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if amount.Amount <= 0 || amount.Amount > balance {
+		tx.Rollback()
+		return ErrPayoutBalance
+	}
+
+	tutor := sql.NullString{String: tutorID, Valid: true}
+	err = addLedgerTransaction(tx, LedgerPayout, sql.NullString{}, tutorID, reference, []ledgerEntry{
+		{Account: LedgerAccountTutor, TutorID: tutor, Amount: amount},
+		{Account: LedgerAccountPayouts, Amount: Money{-amount.Amount, amount.Currency}},
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,187 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Lesson statuses. A lesson is REQUESTED until a tutor accepts it and
+// SCHEDULED once it's both accepted and paid for.
+const (
+	LessonRequested          = "REQUESTED"
+	LessonAccepted           = "ACCEPTED"
+	LessonScheduled          = "SCHEDULED"
+	LessonCompleted          = "COMPLETED"
+	LessonCancelledByStudent = "CANCELLED_BY_STUDENT"
+	LessonCancelledByTutor   = "CANCELLED_BY_TUTOR"
+	LessonNoShow             = "NO_SHOW"
+)
+
+// Lesson status errors.
+var (
+	ErrLessonTransition = errors.New("invalid lesson status transition")
+	ErrLessonNotStarted = errors.New("lesson has not started yet")
+	ErrNotLessonTutor   = errors.New("lesson is not accepted by the tutor")
+)
+
+// lessonTransitions lists the statuses a lesson may move to. COMPLETED,
+// NO_SHOW and the cancellations are final.
+var lessonTransitions = map[string][]string{
+	LessonRequested: {LessonAccepted, LessonCancelledByStudent},
+	LessonAccepted:  {LessonScheduled, LessonCancelledByStudent, LessonCancelledByTutor},
+	LessonScheduled: {LessonCompleted, LessonNoShow, LessonCancelledByStudent, LessonCancelledByTutor},
+}
+
+func canTransitionLesson(from, to string) bool {
+	for _, s := range lessonTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// LessonStatusChange in a lesson's history, by the user UserID or by the
+// system if it's not valid.
+type LessonStatusChange struct {
+	FromStatus sql.NullString `db:"from_status"`
+	ToStatus   string         `db:"to_status"`
+	UserID     sql.NullString `db:"user_id"`
+	UserName   sql.NullString `db:"user_name"`
+	CreatedAt  time.Time      `db:"created_at"`
+}
+
+// transitionLesson moves the lesson to status to and records it in the
+// lesson's history, locking the lesson for the rest of tx. userID is the user
+// making the change, empty for the system. Cancelled lessons are also marked
+// deleted and COMPLETED sets completed_at.
+func transitionLesson(tx *sql.Tx, lessonID, to, userID string) error {
+	var from string
+	if err := tx.QueryRow("SELECT status FROM lessons WHERE id = $1 FOR UPDATE", lessonID).Scan(&from); err != nil {
+		return fmt.Errorf("failed to fetch lesson status %w", err)
+	}
+
+	if !canTransitionLesson(from, to) {
+		return fmt.Errorf("%w: %s to %s", ErrLessonTransition, from, to)
+	}
+
+	query := `
+	UPDATE lessons
+	   SET status = $2,
+	       completed_at = CASE WHEN $2 = 'COMPLETED' THEN CURRENT_TIMESTAMP ELSE completed_at END,
+	       deleted_at = CASE WHEN $2 LIKE 'CANCELLED%' THEN COALESCE(deleted_at, CURRENT_TIMESTAMP) ELSE deleted_at END,
+	       sequence = sequence + CASE WHEN $2 LIKE 'CANCELLED%' THEN 1 ELSE 0 END,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $1`
+	if _, err := tx.Exec(query, lessonID, to); err != nil {
+		return fmt.Errorf("failed to update lesson status %w", err)
+	}
+
+	return addLessonStatusChange(tx, lessonID, sql.NullString{String: from, Valid: true}, to, userID)
+}
+
+// addLessonStatusChange to the lesson's history.
+func addLessonStatusChange(tx *sql.Tx, lessonID string, from sql.NullString, to, userID string) error {
+	query := `
+	INSERT INTO lesson_status_history (lesson_id, from_status, to_status, user_id)
+	VALUES ($1, $2, $3, NULLIF($4, '')::uuid)`
+	if _, err := tx.Exec(query, lessonID, from, to, userID); err != nil {
+		return fmt.Errorf("failed to add lesson status history %w", err)
+	}
+	return nil
+}
+
+// scheduleIfPaid moves an ACCEPTED lesson to SCHEDULED if the student has
+// paid for it.
+func scheduleIfPaid(tx *sql.Tx, lessonID string) error {
+	status, err := lessonRequestStatus(tx, lessonID)
+	if err != nil {
+		return err
+	}
+	if status != LessonRequestPending {
+		return nil
+	}
+	return transitionLesson(tx, lessonID, LessonScheduled, "")
+}
+
+// scheduleAcceptedLessons of the student after a payment.
+func scheduleAcceptedLessons(tx *sql.Tx, studentID string) error {
+	rows, err := tx.Query("SELECT id FROM lessons WHERE student_id = $1 AND status = 'ACCEPTED'", studentID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch accepted lessons %w", err)
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := scheduleIfPaid(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lessonTutorTransition moves the lesson accepted by tutorID to status to,
+// for the tutor's user userID. COMPLETED and NO_SHOW need the lesson to have
+// started.
+func lessonTutorTransition(tx *sql.Tx, lessonID, tutorID, userID, to string) error {
+	var lessonTutor sql.NullString
+	var startAt time.Time
+	query := `SELECT tutor_id, start_at FROM lessons WHERE id = $1`
+	if err := tx.QueryRow(query, lessonID).Scan(&lessonTutor, &startAt); err != nil {
+		return fmt.Errorf("failed to fetch lesson %w", err)
+	}
+	if lessonTutor.String != tutorID {
+		return ErrNotLessonTutor
+	}
+
+	if (to == LessonCompleted || to == LessonNoShow) && startAt.After(time.Now()) {
+		return ErrLessonNotStarted
+	}
+
+	return transitionLesson(tx, lessonID, to, userID)
+}
+
+// CancelLessonByTutor lets the tutor who accepted the lesson cancel it.
+func (c *Core) CancelLessonByTutor(lessonID, tutorID, userID string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := lessonTutorTransition(tx, lessonID, tutorID, userID, LessonCancelledByTutor); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkNoShow lets the tutor record that the student didn't show up.
+func (c *Core) MarkNoShow(lessonID, tutorID, userID string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := lessonTutorTransition(tx, lessonID, tutorID, userID, LessonNoShow); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message errors.
+var (
+	ErrEmptyMessage   = errors.New("message is empty")
+	ErrNotParticipant = errors.New("user is not part of the conversation")
+)
+
+// maxMessage in characters.
+const maxMessage = 5000
+
+// Message in the thread between a lesson's student and one of its tutors.
+type Message struct {
+	ID          int64        `db:"id"`
+	LessonID    string       `db:"lesson_id"`
+	TutorID     string       `db:"tutor_id"`
+	SenderID    string       `db:"sender_id"`
+	SenderName  string       `db:"sender_name"`
+	RecipientID string       `db:"recipient_id"`
+	Body        string       `db:"body"`
+	ReadAt      sql.NullTime `db:"read_at"`
+	CreatedAt   time.Time    `db:"created_at"`
+}
+
+// MessageThread between the student of a lesson and a tutor asked to or
+// applying for it, with the latest message and the user's unread count.
+type MessageThread struct {
+	LessonID      string         `db:"lesson_id"`
+	LessonTitle   string         `db:"lesson_title"`
+	TutorID       string         `db:"tutor_id"`
+	TutorUserID   string         `db:"tutor_user_id"`
+	TutorAlias    string         `db:"tutor_alias"`
+	StudentID     string         `db:"student_id"`
+	StudentName   string         `db:"student_name"`
+	LastMessage   sql.NullString `db:"last_message"`
+	LastMessageAt sql.NullTime   `db:"last_message_at"`
+	Unread        int            `db:"unread"`
+	Open          bool           `db:"open"` // new messages can be sent, see SendMessage
+}
+
+// Has the user as student or tutor.
+func (t MessageThread) Has(userID string) bool {
+	return userID == t.StudentID || userID == t.TutorUserID
+}
+
+// SendMessage from senderID in the thread of lessonID with tutorID. The
+// sender must be the lesson's student or the tutor, and the request must be
+// open to the tutor: pending, accepted or applied for. Requests waiting for
+// payment aren't shown to tutors and closed ones are read only. Notify is
+// true for the recipient's first unread message in the thread, to not send a
+// notification for every message.
+func (c *Core) SendMessage(lessonID, tutorID, senderID, body string) (msg *Message, notify bool, err error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, false, ErrEmptyMessage
+	}
+	if len([]rune(body)) > maxMessage {
+		body = string([]rune(body)[:maxMessage])
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var studentID, tutorUserID string
+	query := `
+	SELECT l.student_id, t.user_id
+	  FROM lesson_requests AS lr
+	  JOIN lessons AS l ON l.id = lr.lesson_id
+	  JOIN tutors AS t ON t.id = lr.tutor_id
+	 WHERE lr.lesson_id = $1
+	   AND lr.tutor_id = $2
+	   AND lr.status IN ('PENDING', 'ACCEPTED', 'APPLIED')`
+	err = tx.QueryRow(query, lessonID, tutorID).Scan(&studentID, &tutorUserID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, false, ErrNotParticipant
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, false, fmt.Errorf("failed to fetch message thread %w", err)
+	}
+
+	msg = &Message{LessonID: lessonID, TutorID: tutorID, SenderID: senderID, Body: body}
+	switch senderID {
+	case studentID:
+		msg.RecipientID = tutorUserID
+	case tutorUserID:
+		msg.RecipientID = studentID
+	default:
+		tx.Rollback()
+		return nil, false, ErrNotParticipant
+	}
+
+	var unread bool
+	query = `
+	SELECT EXISTS (
+	       SELECT 1
+	         FROM lesson_messages
+	        WHERE lesson_id = $1
+	          AND tutor_id = $2
+	          AND recipient_id = $3
+	          AND read_at IS NULL)`
+	if err := tx.QueryRow(query, lessonID, tutorID, msg.RecipientID).Scan(&unread); err != nil {
+		tx.Rollback()
+		return nil, false, fmt.Errorf("failed to fetch unread messages %w", err)
+	}
+
+	query = `
+	INSERT INTO lesson_messages (lesson_id, tutor_id, sender_id, recipient_id, body)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+	err = tx.QueryRow(query, lessonID, tutorID, senderID, msg.RecipientID, body).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, false, fmt.Errorf("failed to add message %w", err)
+	}
+
+	return msg, !unread, tx.Commit()
+}
+
+// MarkThreadRead marks the messages to userID in the thread as read.
+func (c *Core) MarkThreadRead(lessonID, tutorID, userID string) error {
+	query := `
+	UPDATE lesson_messages
+	   SET read_at = CURRENT_TIMESTAMP
+	 WHERE lesson_id = $1
+	   AND tutor_id = $2
+	   AND recipient_id = $3
+	   AND read_at IS NULL`
+	if _, err := c.db.Exec(query, lessonID, tutorID, userID); err != nil {
+		return fmt.Errorf("failed to mark messages read %w", err)
+	}
+	return nil
+}
@@ -1,60 +1,72 @@
 package model
 
 import (
-	"math"
+	"database/sql"
+	"errors"
+	"fmt"
 	"upforschool/internal/pkg/worldline"
 
 	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
 )
 
-type Cost struct {
-	Total    float64
-	Discount float64
-	Tax      float64
-}
+// Product categories.
+const (
+	ProductCategoryLesson = "LESSON"
+)
 
-func calculateCost(price, taxPercentage, discountPercentage float64) Cost {
-	costInCents := price * 100
-	discount := costInCents * (discountPercentage / 100.0)
-	discount = math.Round(discount)
+// LessonProduct is paid once per lesson request.
+var LessonProduct = struct {
+	Name     string
+	Cost     Money
+	Tax      int64 // VAT percent
+	Category string
+}{
+	Name:     "Förfrågan studiecoach",
+	Cost:     Money{4900, "SEK"},
+	Tax:      25,
+	Category: ProductCategoryLesson,
+}
 
-	total := costInCents - discount
+type Cost struct {
+	Total    Money
+	Discount Money
+	Tax      Money
+}
 
-	quotient := taxPercentage/100 + 1
-	wotax := math.Round(total / quotient)
-	taxamount := total - wotax
+// calculateCost of price including VAT at taxPercentage after discount. See
+// Money.VAT for how the VAT is rounded.
+func calculateCost(price Money, taxPercentage int64, discount Money) Cost {
+	total := price.Sub(discount)
 
 	return Cost{
-		Total:    total / 100,
-		Discount: discount / 100,
-		Tax:      taxamount / 100,
+		Total:    total,
+		Discount: discount,
+		Tax:      total.VAT(taxPercentage),
 	}
 }
 
 type OrderAdd struct {
-	GameID          int64
+	LessonID        string
 	Quantity        int
 	ReferenceUser   string
 	ReferenceNumber string
 	ProductName     string
-	ProductCost     float64
-	ProductTax      float64
+	ProductCost     Money
+	ProductTax      int64
 	ProductCategory string
-	Currency        string
 }
 
 func (c *Core) AddOrder(o *OrderAdd) (int64, error) {
-	discount := 0.0
-
-	if o.Currency == "" {
-		o.Currency = "SEK"
+	if o.ProductCost.Currency == "" {
+		o.ProductCost.Currency = "SEK"
 	}
 
-	cost := calculateCost(o.ProductCost, o.ProductTax, discount)
+	cost := calculateCost(o.ProductCost, o.ProductTax, Money{0, o.ProductCost.Currency})
 
 	query := `
     INSERT INTO orders (
-           game_id,
+           lesson_id,
            quantity,
            amount,
            tax_amount,
@@ -72,28 +84,63 @@ func (c *Core) AddOrder(o *OrderAdd) (int64, error) {
 
 	var resultID int64
 	err := c.db.Get(&resultID, query,
-		o.GameID,
+		o.LessonID,
 		o.Quantity,
-		cost.Total,
-		cost.Tax,
-		cost.Discount,
+		cost.Total.Amount,
+		cost.Tax.Amount,
+		cost.Discount.Amount,
 		o.ProductName,
-		o.ProductCost,
+		o.ProductCost.Amount,
 		o.ProductTax,
 		o.ProductCategory,
 		o.ReferenceUser,
 		o.ReferenceNumber,
-		"CREATED",
-		o.Currency,
+		PaymentCreated,
+		o.ProductCost.Currency,
 	)
 
 	return resultID, err
 }
 
+type UpdateOrderCurrencyRequest struct {
+	LessonID    string
+	ProductCost Money
+	ProductTax  int64
+}
+
+func (c *Core) UpdateOrderCurrency(r UpdateOrderCurrencyRequest) error {
+
+	cost := calculateCost(r.ProductCost, r.ProductTax, Money{0, r.ProductCost.Currency})
+
+	query := `
+    UPDATE orders SET
+		amount = $2,
+		tax_amount = $3,
+		discount_id = $4,
+		discount_amount = $5,
+		product_cost = $6,
+		product_tax = $7,
+		currency = $8
+    WHERE lesson_id = $1
+	AND STATUS = 'CREATED'
+	RETURNING id
+	`
+	var updatedID int64
+	return c.db.Get(&updatedID, query,
+		r.LessonID,
+		cost.Total.Amount,
+		cost.Tax.Amount,
+		nil,
+		0,
+		r.ProductCost.Amount,
+		r.ProductTax,
+		r.ProductCost.Currency,
+	)
+}
+
 type OrderPaymentRequest struct {
 	OrderID   int64
-	Amount    float64
-	Currency  worldline.Currency
+	Amount    Money
 	Reference string
 }
 
@@ -101,17 +148,23 @@ type OrderPaymentResponse struct {
 	RedirectURL string
 }
 
+// AddOrderPayment starts a worldline checkout session for the order. Returns
+// ErrDiscountExpired if the order's discount code has been redeemed elsewhere.
 func (c *Core) AddOrderPayment(payment OrderPaymentRequest) (*OrderPaymentResponse, error) {
 	id, err := uuid.NewV4()
 	if err != nil {
 		return nil, err
 	}
 
+	if err := c.holdOrderDiscount(payment.OrderID); err != nil {
+		return nil, err
+	}
+
 	query := `
     INSERT INTO order_payments (id, order_id, message, reference)
 	VALUES ($1, $2, $3, $4)`
 
-	request := c.worldline.NewOrder(payment.OrderID, payment.Amount, payment.Currency)
+	request := c.worldline.NewOrder(payment.OrderID, payment.Amount.Amount, worldline.Currency(payment.Amount.Currency))
 
 	order, err := c.worldline.CreateOrder(request)
 	// log error
@@ -123,6 +176,9 @@ func (c *Core) AddOrderPayment(payment OrderPaymentRequest) (*OrderPaymentRespon
 			payment.Reference); dberr != nil {
 			return nil, dberr
 		}
+		if serr := c.setPaymentStatus("orders", payment.OrderID, PaymentFailed); serr != nil {
+			return nil, serr
+		}
 		return nil, err
 	}
 
@@ -132,17 +188,136 @@ func (c *Core) AddOrderPayment(payment OrderPaymentRequest) (*OrderPaymentRespon
 		payment.OrderID,
 		order.URL,
 		payment.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.setPaymentStatus("orders", payment.OrderID, PaymentPending); err != nil {
+		return nil, err
+	}
 
-	return &OrderPaymentResponse{order.URL}, err
+	return &OrderPaymentResponse{order.URL}, nil
 }
 
-func (c *Core) CompleteOrder(id int64) error {
+// CompleteOrderPayment records the worldline callback and completes the
+// order. Callbacks are recorded once per transaction ID; a repeated callback
+// returns ErrDuplicateCallback and changes nothing.
+func (c *Core) CompleteOrderPayment(orderID int64, cb PaymentCallback) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	orderRef := sql.NullInt64{Int64: orderID, Valid: true}
+	if err := recordPaymentEvent(tx, cb.TxnID, orderRef, sql.NullInt64{}, cb.Params); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	query := `
-	UPDATE orders
-	   SET status = 'COMPLETED',
-	       updated_at = CURRENT_TIMESTAMP
-     WHERE id = $1`
+    INSERT INTO order_payments (id, order_id, message, reference)
+	VALUES ($1, $2, $3, $4)`
+
+	if _, err := tx.Exec(query, id, orderID, cb.Params, cb.TxnID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := checkPaymentAmount(tx, "orders", orderID, cb.Amount); err != nil {
+		if !errors.Is(err, ErrPaymentAmount) {
+			tx.Rollback()
+			return err
+		}
+		if _, terr := transitionPayment(tx, "orders", orderID, PaymentFailed); terr != nil {
+			tx.Rollback()
+			return terr
+		}
+		if cerr := tx.Commit(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+
+	if err := completeOrder(tx, orderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CompleteOrder marks the order as paid and releases the lesson requests
+// held while awaiting payment. Returns ErrDiscountExpired if the order's
+// discount code has been redeemed elsewhere.
+func (c *Core) CompleteOrder(id int64) error {
+	if err := c.holdOrderDiscount(id); err != nil {
+		return err
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := completeOrder(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func completeOrder(tx *sqlx.Tx, id int64) error {
+	changed, err := transitionPayment(tx, "orders", id, PaymentCompleted)
+	if err != nil {
+		return fmt.Errorf("failed to complete order %w", err)
+	}
+
+	// already completed by an earlier callback.
+	if !changed {
+		return nil
+	}
+
+	var lessonID sql.NullString
+	if err := tx.Get(&lessonID, "SELECT lesson_id FROM orders WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	if lessonID.Valid {
+		query := `
+		UPDATE lesson_requests
+		   SET status = 'PENDING',
+		       updated_at = CURRENT_TIMESTAMP
+		 WHERE lesson_id = $1
+		   AND status = 'AWAITING_PAYMENT'`
+		if _, err := tx.Exec(query, lessonID.String); err != nil {
+			return fmt.Errorf("failed to release lesson requests %w", err)
+		}
+
+		var studentID string
+		if err := tx.Get(&studentID, "SELECT student_id FROM lessons WHERE id = $1", lessonID.String); err != nil {
+			return err
+		}
+		if err := acceptReleasedSeriesLessons(tx.Tx, studentID); err != nil {
+			return err
+		}
+		if err := scheduleAcceptedLessons(tx.Tx, studentID); err != nil {
+			return err
+		}
+		if err := publishOpenLessons(tx.Tx, studentID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	_, err := c.db.Exec(query, id)
-	return err
+// ValidateCallback query from worldline.
+func (c *Core) ValidateCallback(rawQuery string) bool {
+	return c.worldline.Validate(rawQuery)
 }
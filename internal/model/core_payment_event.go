@@ -0,0 +1,127 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Payment statuses for orders and subscriptions.
+const (
+	PaymentCreated   = "CREATED"
+	PaymentPending   = "PENDING"
+	PaymentCompleted = "COMPLETED"
+	PaymentFailed    = "FAILED"
+	PaymentRefunding = "REFUNDING"
+	PaymentRefunded  = "REFUNDED"
+)
+
+// Payment errors.
+var (
+	ErrPaymentTransition = errors.New("invalid payment status transition")
+	ErrDuplicateCallback = errors.New("duplicate payment callback")
+	ErrPaymentAmount     = errors.New("payment amount does not match")
+)
+
+// paymentTransitions lists the statuses an order or subscription may move to.
+// A new checkout session may be started from PENDING or FAILED. A refund is
+// REFUNDING while worldline is called and goes back to COMPLETED if it fails.
+var paymentTransitions = map[string][]string{
+	PaymentCreated:   {PaymentPending, PaymentCompleted, PaymentFailed},
+	PaymentPending:   {PaymentCompleted, PaymentFailed},
+	PaymentFailed:    {PaymentPending},
+	PaymentCompleted: {PaymentRefunding},
+	PaymentRefunding: {PaymentRefunded, PaymentCompleted},
+}
+
+func canTransitionPayment(from, to string) bool {
+	for _, s := range paymentTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentCallback from worldline.
+type PaymentCallback struct {
+	TxnID  string
+	Amount int64 // in minor units
+	Params string
+}
+
+// transitionPayment moves the row id in table ("orders" or "subscriptions")
+// to status to, locking the row for the rest of tx. Moving to the current
+// status is a no-op and reports changed as false.
+func transitionPayment(tx *sqlx.Tx, table string, id int64, to string) (changed bool, err error) {
+	var from string
+	if err := tx.Get(&from, "SELECT status FROM "+table+" WHERE id = $1 FOR UPDATE", id); err != nil {
+		return false, err
+	}
+
+	if from == to {
+		return false, nil
+	}
+
+	if !canTransitionPayment(from, to) {
+		return false, fmt.Errorf("%w: %s to %s", ErrPaymentTransition, from, to)
+	}
+
+	query := "UPDATE " + table + " SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1"
+	if _, err := tx.Exec(query, id, to); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *Core) setPaymentStatus(table string, id int64, to string) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := transitionPayment(tx, table, id, to); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordPaymentEvent keyed by the worldline transaction ID. Returns
+// ErrDuplicateCallback if the transaction has already been recorded.
+func recordPaymentEvent(tx *sqlx.Tx, txnID string, orderID, subscriptionID sql.NullInt64, params string) error {
+	if txnID == "" {
+		return errors.New("missing transaction ID")
+	}
+
+	query := `
+	INSERT INTO payment_events (txn_id, order_id, subscription_id, params)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (txn_id) DO NOTHING
+	RETURNING id`
+
+	var id int64
+	err := tx.Get(&id, query, txnID, orderID, subscriptionID, params)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateCallback
+	}
+	return err
+}
+
+// checkPaymentAmount compares the paid amount in minor units with the amount
+// stored in table.
+func checkPaymentAmount(tx *sqlx.Tx, table string, id int64, paid int64) error {
+	var amount int64
+	if err := tx.Get(&amount, "SELECT amount FROM "+table+" WHERE id = $1", id); err != nil {
+		return err
+	}
+
+	if amount != paid {
+		return fmt.Errorf("%w: expected %d, got %d", ErrPaymentAmount, amount, paid)
+	}
+	return nil
+}
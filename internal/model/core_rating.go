@@ -0,0 +1,130 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Rating errors.
+var (
+	ErrRatingGrade    = errors.New("grade must be between 1 and 5")
+	ErrNotRateable    = errors.New("lesson can't be rated until it has been held")
+	ErrAlreadyRated   = errors.New("lesson has already been rated")
+	ErrRatingNotFound = errors.New("rating not found")
+)
+
+// maxRatingText in characters, for feedback and replies.
+const maxRatingText = 2000
+
+// Rating of a lesson by its student, with the tutor's reply. Hidden ratings
+// are only shown to the tutor and admins and don't count to the average.
+type Rating struct {
+	ID          int64          `db:"id"`
+	LessonID    string         `db:"lesson_id"`
+	TutorID     string         `db:"tutor_id"`
+	Grade       int            `db:"grade"`
+	Feedback    string         `db:"feedback"`
+	Reply       sql.NullString `db:"reply"`
+	RepliedAt   sql.NullTime   `db:"replied_at"`
+	HiddenAt    sql.NullTime   `db:"hidden_at"`
+	CreatedAt   time.Time      `db:"created_at"`
+	StudentName string         `db:"student_name"`
+	LessonTitle string         `db:"lesson_title"`
+}
+
+func trimRatingText(s string) string {
+	s = strings.TrimSpace(s)
+	if len([]rune(s)) > maxRatingText {
+		s = string([]rune(s)[:maxRatingText])
+	}
+	return s
+}
+
+// RateLesson lets the student grade a lesson 1-5 once, after it was accepted
+// and its time has passed.
+func (c *Core) RateLesson(lessonID, studentID string, grade int, feedback string) error {
+	if grade < 1 || grade > 5 {
+		return ErrRatingGrade
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var tutorID sql.NullString
+	var rateable bool
+	query := `
+	SELECT tutor_id,
+	       status IN ('ACCEPTED', 'SCHEDULED', 'COMPLETED')
+	       AND start_at + duration * INTERVAL '1 minute' <= CURRENT_TIMESTAMP
+	  FROM lessons
+	 WHERE id = $1
+	   AND student_id = $2
+	   FOR UPDATE`
+	err = tx.QueryRow(query, lessonID, studentID).Scan(&tutorID, &rateable)
+	if err == sql.ErrNoRows || err == nil && (!rateable || !tutorID.Valid) {
+		tx.Rollback()
+		return ErrNotRateable
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch lesson %w", err)
+	}
+
+	query = `
+	INSERT INTO ratings (lesson_id, tutor_id, grade, feedback)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (lesson_id) DO NOTHING`
+	res, err := tx.Exec(query, lessonID, tutorID.String, grade, trimRatingText(feedback))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to add rating %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return ErrAlreadyRated
+	}
+
+	return tx.Commit()
+}
+
+// ReplyToRating of the tutor, replacing any earlier reply. An empty reply
+// removes it.
+func (c *Core) ReplyToRating(ratingID int64, tutorID, reply string) error {
+	query := `
+	UPDATE ratings
+	   SET reply = NULLIF($3, ''),
+	       replied_at = CASE WHEN $3 = '' THEN NULL ELSE CURRENT_TIMESTAMP END,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $1
+	   AND tutor_id = $2`
+	res, err := c.db.Exec(query, ratingID, tutorID, trimRatingText(reply))
+	if err != nil {
+		return fmt.Errorf("failed to reply to rating %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRatingNotFound
+	}
+	return nil
+}
+
+// HideRating from the tutor's public reviews and average, or shows it again.
+func (c *Core) HideRating(ratingID int64, hidden bool) error {
+	query := `
+	UPDATE ratings
+	   SET hidden_at = CASE WHEN $2 THEN COALESCE(hidden_at, CURRENT_TIMESTAMP) END,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $1`
+	res, err := c.db.Exec(query, ratingID, hidden)
+	if err != nil {
+		return fmt.Errorf("failed to hide rating %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRatingNotFound
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+)
+
+// Refund errors.
+var (
+	// ErrRefundNoTransaction is returned for orders completed without a
+	// worldline payment, e.g. fully discounted orders.
+	ErrRefundNoTransaction = errors.New("order has no payment transaction to refund")
+	// ErrRefundLessonHeld is returned for orders whose lesson has been held
+	// and credited to the tutor.
+	ErrRefundLessonHeld = errors.New("lesson has been held and credited to the tutor")
+)
+
+type refundOrder struct {
+	Amount   int64
+	LessonID sql.NullString
+	TxnID    string
+}
+
+// RefundOrder refunds a completed order in full through worldline, marks it
+// REFUNDED and cancels the lesson. Lessons already credited to the tutor can't
+// be refunded. Every attempt and its outcome is logged in order_payments.
+//
+// The order is marked REFUNDING before worldline is called, outside of any
+// transaction, so it can't be refunded twice. An order left REFUNDING didn't
+// get the outcome recorded and has to be checked against worldline.
+func (c *Core) RefundOrder(orderID int64, reason string) error {
+	order, err := c.startRefund(orderID)
+	if err != nil {
+		return err
+	}
+
+	refundErr := c.worldline.Refund(order.TxnID, order.Amount)
+
+	if err := c.finishRefund(orderID, order, reason, refundErr); err != nil {
+		return err
+	}
+
+	if refundErr != nil {
+		return fmt.Errorf("failed to refund order %w", refundErr)
+	}
+	return nil
+}
+
+// startRefund checks that the order can be refunded and marks it REFUNDING.
+func (c *Core) startRefund(orderID int64) (*refundOrder, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	var order struct {
+		Status   string         `db:"status"`
+		Amount   int64          `db:"amount"`
+		LessonID sql.NullString `db:"lesson_id"`
+	}
+	query := "SELECT status, amount, lesson_id FROM orders WHERE id = $1 FOR UPDATE"
+	if err := tx.Get(&order, query, orderID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if !canTransitionPayment(order.Status, PaymentRefunding) {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: %s to %s", ErrPaymentTransition, order.Status, PaymentRefunding)
+	}
+
+	// CompleteLesson reads the order FOR SHARE, so a lesson completed while
+	// the order is locked is seen here.
+	if order.LessonID.Valid {
+		var held bool
+		query = "SELECT EXISTS (SELECT 1 FROM ledger_transactions WHERE lesson_id = $1 AND kind = $2)"
+		if err := tx.Get(&held, query, order.LessonID.String, LedgerLesson); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if held {
+			tx.Rollback()
+			return nil, ErrRefundLessonHeld
+		}
+	}
+
+	var txnID string
+	query = `
+	SELECT txn_id
+	  FROM payment_events
+	 WHERE order_id = $1
+	 ORDER BY created_at DESC
+	 LIMIT 1`
+	err = tx.Get(&txnID, query, orderID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, ErrRefundNoTransaction
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if _, err := transitionPayment(tx, "orders", orderID, PaymentRefunding); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &refundOrder{Amount: order.Amount, LessonID: order.LessonID, TxnID: txnID}, nil
+}
+
+// finishRefund logs the worldline outcome and marks the order REFUNDED,
+// cancelling its lesson, or back to COMPLETED if the refund failed.
+func (c *Core) finishRefund(orderID int64, order *refundOrder, reason string, refundErr error) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	message := "refund: " + reason
+	if refundErr != nil {
+		message = "refund failed: " + reason + ": " + refundErr.Error()
+	}
+
+	query := `
+    INSERT INTO order_payments (id, order_id, message, reference)
+	VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(query, id, orderID, message, order.TxnID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if refundErr != nil {
+		if _, err := transitionPayment(tx, "orders", orderID, PaymentCompleted); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if _, err := transitionPayment(tx, "orders", orderID, PaymentRefunded); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if order.LessonID.Valid {
+		// a lesson that has already been held or cancelled keeps its status,
+		// and so do its requests.
+		err := transitionLesson(tx.Tx, order.LessonID.String, LessonCancelledByStudent, "")
+		if errors.Is(err, ErrLessonTransition) {
+			return tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to cancel lesson %w", err)
+		}
+
+		query = `
+		UPDATE lesson_requests
+		   SET status = 'CANCELLED',
+		       updated_at = CURRENT_TIMESTAMP
+		 WHERE lesson_id = $1
+		   AND status != 'CANCELLED'`
+		if _, err := tx.Exec(query, order.LessonID.String); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to cancel lesson requests %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
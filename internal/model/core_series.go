@@ -0,0 +1,297 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// LessonRecurrence repeats a lesson every Interval weeks, Count times or
+// until the date Until, "2006-01-02", whichever comes first.
+type LessonRecurrence struct {
+	Interval int    `json:"interval"` // weeks, 1 or 2
+	Count    int    `json:"count"`
+	Until    string `json:"until"`
+}
+
+// maxSeriesLessons in one series, about a school year of weekly lessons.
+const maxSeriesLessons = 40
+
+// Lesson series errors.
+var (
+	ErrRecurrence          = errors.New("a series repeats every 1 or 2 weeks, until a date or at most 40 times")
+	ErrSeriesSlots         = errors.New("a series has a single proposed time")
+	ErrSeriesNotAcceptable = errors.New("the series has no lessons the tutor can accept")
+	ErrNotInSeries         = errors.New("lesson is not part of a series")
+)
+
+// occurrences of the recurrence from start. Lessons keep their local time in
+// Timezone over daylight saving changes.
+func (r LessonRecurrence) occurrences(start time.Time) ([]time.Time, error) {
+	if r.Interval != 1 && r.Interval != 2 {
+		return nil, ErrRecurrence
+	}
+
+	var until time.Time
+	if r.Until != "" {
+		day, err := time.ParseInLocation("2006-01-02", r.Until, Timezone)
+		if err != nil {
+			return nil, ErrRecurrence
+		}
+		until = day.AddDate(0, 0, 1) // the whole day
+	}
+
+	if r.Count < 0 || r.Count > maxSeriesLessons || r.Count == 0 && until.IsZero() {
+		return nil, ErrRecurrence
+	}
+
+	local := start.In(Timezone)
+	var result []time.Time
+	for i := 0; r.Count == 0 || i < r.Count; i++ {
+		t := local.AddDate(0, 0, 7*r.Interval*i)
+		if !until.IsZero() && !t.Before(until) {
+			break
+		}
+		if len(result) == maxSeriesLessons {
+			return nil, ErrRecurrence
+		}
+		result = append(result, t)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrRecurrence
+	}
+	return result, nil
+}
+
+// addLessonSeries for the student.
+func addLessonSeries(tx *sql.Tx, userID string, r LessonRecurrence) (sql.NullString, error) {
+	id := uuid.Must(uuid.NewV4())
+
+	var until sql.NullString
+	if r.Until != "" {
+		until = sql.NullString{String: r.Until, Valid: true}
+	}
+
+	query := `
+	INSERT INTO lesson_series (id, student_id, interval_weeks, count, until)
+	VALUES ($1, $2, $3, NULLIF($4, 0), $5)`
+	if _, err := tx.Exec(query, id, userID, r.Interval, r.Count, until); err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to add lesson series %w", err)
+	}
+
+	return sql.NullString{String: id.String(), Valid: true}, nil
+}
+
+// AcceptSeries for tutorID, once for every lesson in the series. Lessons the
+// student hasn't paid for yet are accepted when they are paid. Lessons that
+// overlap the tutor's other lessons are left for the tutor to handle one by
+// one.
+func (c *Core) AcceptSeries(seriesID, tutorID string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var current sql.NullString
+	query := `
+	SELECT tutor_id
+	  FROM lesson_series
+	 WHERE id = $1
+	   AND cancelled_at IS NULL
+	   FOR UPDATE`
+	err = tx.QueryRow(query, seriesID).Scan(&current)
+	if err == sql.ErrNoRows || err == nil && current.Valid && current.String != tutorID {
+		tx.Rollback()
+		return ErrSeriesNotAcceptable
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch lesson series %w", err)
+	}
+
+	accepted, err := acceptSeriesLessons(tx, seriesID, tutorID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if accepted == 0 {
+		tx.Rollback()
+		return ErrSeriesNotAcceptable
+	}
+
+	query = `
+	UPDATE lesson_series
+	   SET tutor_id = $2,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $1`
+	if _, err := tx.Exec(query, seriesID, tutorID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to accept lesson series %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// acceptSeriesLessons of the series with a pending request for the tutor,
+// returns how many were accepted.
+func acceptSeriesLessons(tx *sql.Tx, seriesID, tutorID string) (int, error) {
+	query := `
+	SELECT l.id, s.id
+	  FROM lessons AS l
+	  JOIN lesson_requests AS lr ON lr.lesson_id = l.id
+	  JOIN lesson_slots AS s ON s.lesson_id = l.id AND s.released_at IS NULL
+	 WHERE l.series_id = $1
+	   AND lr.tutor_id = $2
+	   AND lr.status = 'PENDING'
+	   AND l.tutor_id IS NULL
+	   AND l.deleted_at IS NULL
+	   AND l.start_at > CURRENT_TIMESTAMP
+	 ORDER BY l.start_at`
+
+	rows, err := tx.Query(query, seriesID, tutorID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch series lessons %w", err)
+	}
+
+	type occurrence struct {
+		lessonID string
+		slotID   int64
+	}
+	var occurrences []occurrence
+	for rows.Next() {
+		var o occurrence
+		if err := rows.Scan(&o.lessonID, &o.slotID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		occurrences = append(occurrences, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	accepted := 0
+	for _, o := range occurrences {
+		err := acceptLesson(tx, o.lessonID, tutorID, o.slotID)
+		if errors.Is(err, ErrTutorBusy) || errors.Is(err, ErrSlotUnavailable) ||
+			errors.Is(err, ErrLessonTaken) || errors.Is(err, ErrRequestNotPending) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		accepted++
+	}
+
+	return accepted, nil
+}
+
+// acceptReleasedSeriesLessons of the student's accepted series, after lesson
+// requests are released by a payment.
+func acceptReleasedSeriesLessons(tx *sql.Tx, studentID string) error {
+	query := `
+	SELECT id, tutor_id
+	  FROM lesson_series
+	 WHERE student_id = $1
+	   AND tutor_id IS NOT NULL
+	   AND cancelled_at IS NULL`
+
+	rows, err := tx.Query(query, studentID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch lesson series %w", err)
+	}
+
+	var series [][2]string
+	for rows.Next() {
+		var id, tutorID string
+		if err := rows.Scan(&id, &tutorID); err != nil {
+			rows.Close()
+			return err
+		}
+		series = append(series, [2]string{id, tutorID})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range series {
+		if _, err := acceptSeriesLessons(tx, s[0], s[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelSeries from the lesson on for the student userID, the lesson and
+// every later lesson in its series that hasn't been held.
+func (c *Core) CancelSeries(lessonID, userID string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var seriesID sql.NullString
+	var startAt time.Time
+	query := `SELECT series_id, start_at FROM lessons WHERE id = $1`
+	if err := tx.QueryRow(query, lessonID).Scan(&seriesID, &startAt); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch lesson %w", err)
+	}
+	if !seriesID.Valid {
+		tx.Rollback()
+		return ErrNotInSeries
+	}
+
+	query = `
+	SELECT id
+	  FROM lessons
+	 WHERE series_id = $1
+	   AND start_at >= $2
+	   AND status IN ('REQUESTED', 'ACCEPTED', 'SCHEDULED')`
+	rows, err := tx.Query(query, seriesID, startAt)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to fetch series lessons %w", err)
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, id := range ids {
+		if err := transitionLesson(tx, id, LessonCancelledByStudent, userID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to cancel series lessons %w", err)
+		}
+	}
+
+	query = `
+	UPDATE lesson_series
+	   SET cancelled_at = CURRENT_TIMESTAMP,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $1`
+	if _, err := tx.Exec(query, seriesID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to cancel lesson series %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,328 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"upforschool/internal/pkg/worldline"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+type SubscriptionAdd struct {
+	PlanID       int64
+	UserID       string
+	Reference    string
+	DiscountCode string
+}
+
+type subscriptionPlan struct {
+	ID       int64  `db:"id"`
+	Name     string `db:"name"`
+	Role     string `db:"role"`
+	Period   int64  `db:"period"`
+	Interval int64  `db:"interval"`
+	Price    int64  `db:"price"`
+	Tax      int64  `db:"tax"`
+	Currency string `db:"currency"`
+}
+
+func (c *Core) subscriptionPlanByID(id int64) (*subscriptionPlan, error) {
+	query := `
+	SELECT p.id AS id,
+           p.name,
+           p.role,
+           p.period,
+           p.interval,
+           p.price,
+		   p.tax,
+           p.currency
+      FROM plans AS p
+     WHERE p.id = $1
+       AND p.active`
+
+	var p subscriptionPlan
+	return &p, c.db.Get(&p, query, id)
+}
+
+// AddSubscription for plan. A discount code is validated and recorded in the
+// same transaction as the subscription.
+func (c *Core) AddSubscription(sub *SubscriptionAdd) (int64, error) {
+	plan, err := c.subscriptionPlanByID(sub.PlanID)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	price := Money{plan.Price, plan.Currency}
+	discount := Money{0, plan.Currency}
+	discountID := sql.NullInt64{}
+	if sub.DiscountCode != "" {
+		d, err := lockDiscountByCode(tx, sub.DiscountCode, 0, 0)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		discount, err = d.Discount(price)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		discountID.Int64 = d.ID
+		discountID.Valid = true
+	}
+
+	cost := calculateCost(price, plan.Tax, discount)
+
+	query := `
+	INSERT INTO subscriptions (
+           plan_id,
+           user_id,
+           discount_id,
+		   reference,
+           amount,
+           tax_amount,
+           discount_amount)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+ RETURNING id`
+
+	var id int64
+	if err := tx.Get(&id, query,
+		plan.ID,
+		sub.UserID,
+		discountID,
+		sub.Reference,
+		cost.Total.Amount,
+		cost.Tax.Amount,
+		cost.Discount.Amount); err != nil {
+		tx.Rollback()
+		return id, err
+	}
+
+	return id, tx.Commit()
+}
+
+type SubscriptionPaymentRequest struct {
+	SubscriptionID int64
+	Amount         Money
+	Reference      string
+}
+
+type SubscriptionPaymentResponse struct {
+	RedirectURL string
+}
+
+func (c *Core) AddSubscriptionPayment(payment SubscriptionPaymentRequest) (*SubscriptionPaymentResponse, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+    INSERT INTO subscription_payments (id, subscription_id, message, reference)
+	VALUES ($1, $2, $3, $4)`
+
+	request := c.worldline.NewSubscription(payment.SubscriptionID, payment.Amount.Amount, worldline.Currency(payment.Amount.Currency))
+
+	order, err := c.worldline.CreateOrder(request)
+
+	// log error
+	if err != nil {
+		if _, dberr := c.db.Exec(query,
+			id,
+			payment.SubscriptionID,
+			err.Error(),
+			payment.Reference); dberr != nil {
+			return nil, dberr
+		}
+		if serr := c.setPaymentStatus("subscriptions", payment.SubscriptionID, PaymentFailed); serr != nil {
+			return nil, serr
+		}
+
+		return nil, err
+	}
+
+	// log redirect
+	_, err = c.db.Exec(query,
+		id,
+		payment.SubscriptionID,
+		order.URL,
+		payment.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.setPaymentStatus("subscriptions", payment.SubscriptionID, PaymentPending); err != nil {
+		return nil, err
+	}
+
+	return &SubscriptionPaymentResponse{order.URL}, nil
+}
+
+// CompleteSubscriptionPayment records the worldline callback and activates
+// the subscription. Callbacks are recorded once per transaction ID; a
+// repeated callback returns ErrDuplicateCallback and changes nothing.
+func (c *Core) CompleteSubscriptionPayment(subscriptionID int64, cb PaymentCallback) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	subscriptionRef := sql.NullInt64{Int64: subscriptionID, Valid: true}
+	if err := recordPaymentEvent(tx, cb.TxnID, sql.NullInt64{}, subscriptionRef, cb.Params); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `
+    INSERT INTO subscription_payments (id, subscription_id, message, reference)
+	VALUES ($1, $2, $3, $4)`
+
+	if _, err := tx.Exec(query, id, subscriptionID, cb.Params, cb.TxnID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := checkPaymentAmount(tx, "subscriptions", subscriptionID, cb.Amount); err != nil {
+		if !errors.Is(err, ErrPaymentAmount) {
+			tx.Rollback()
+			return err
+		}
+		if _, terr := transitionPayment(tx, "subscriptions", subscriptionID, PaymentFailed); terr != nil {
+			tx.Rollback()
+			return terr
+		}
+		if cerr := tx.Commit(); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+
+	if err := completeSubscription(tx, subscriptionID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CompleteSubscription marks the subscription as paid and activates it.
+func (c *Core) CompleteSubscription(id int64) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := completeSubscription(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func completeSubscription(tx *sqlx.Tx, id int64) error {
+	changed, err := transitionPayment(tx, "subscriptions", id, PaymentCompleted)
+	if err != nil {
+		return fmt.Errorf("failed to complete subscription %w", err)
+	}
+
+	// already activated by an earlier callback.
+	if !changed {
+		return nil
+	}
+
+	return activateSubscription(tx, id)
+}
+
+// activateSubscription for the plan period and release the lesson requests
+// the subscriber has waiting for payment.
+func activateSubscription(tx *sqlx.Tx, id int64) error {
+	// a renewal starts when the subscriber's current period ends.
+	query := `
+	UPDATE subscriptions AS s
+       SET activated_at = CURRENT_TIMESTAMP,
+           starts_at = r.starts_at,
+           ends_at = (r.starts_at + interval '1 month' * p.period)
+      FROM plans AS p,
+           (
+           SELECT GREATEST(CURRENT_TIMESTAMP, MAX(prev.ends_at)) AS starts_at
+             FROM subscriptions AS prev
+            WHERE prev.user_id = (SELECT user_id FROM subscriptions WHERE id = $1)
+              AND prev.id != $1
+              AND prev.activated_at IS NOT NULL
+           ) AS r
+     WHERE s.id = $1
+       AND p.id = s.plan_id
+ RETURNING s.user_id`
+
+	var userID string
+	if err := tx.Get(&userID, query, id); err != nil {
+		return fmt.Errorf("failed to activate subscription %w", err)
+	}
+
+	query = `
+	UPDATE lesson_requests AS lr
+	   SET status = 'PENDING',
+	       updated_at = CURRENT_TIMESTAMP
+	  FROM lessons AS l
+	 WHERE lr.lesson_id = l.id
+	   AND l.student_id = $1
+	   AND l.deleted_at IS NULL
+	   AND lr.status = 'AWAITING_PAYMENT'`
+	if _, err := tx.Exec(query, userID); err != nil {
+		return fmt.Errorf("failed to release lesson requests %w", err)
+	}
+
+	if err := acceptReleasedSeriesLessons(tx.Tx, userID); err != nil {
+		return err
+	}
+	if err := scheduleAcceptedLessons(tx.Tx, userID); err != nil {
+		return err
+	}
+	return publishOpenLessons(tx.Tx, userID)
+}
+
+// MarkSubscriptionReminded so the renewal reminder is only sent once.
+func (c *Core) MarkSubscriptionReminded(id int64) error {
+	query := `
+	UPDATE subscriptions
+	   SET reminded_at = CURRENT_TIMESTAMP,
+	       updated_at = CURRENT_TIMESTAMP
+	 WHERE id = $1`
+
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+func (c *Core) RemoveSubscription(id int64) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM subscription_payments WHERE subscription_id = $1", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM subscriptions WHERE id = $1", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestAcceptLessonConcurrent has two tutors accept the same lesson at once,
+// only the first one gets it.
+func TestAcceptLessonConcurrent(t *testing.T) {
+	db := testDB(t)
+	c := NewCore(db, nil)
+
+	student := addTestUser(t, db, "Elev")
+	tutors := make([]string, 3)
+	for i := range tutors {
+		tutors[i] = addTestTutor(t, db, addTestUser(t, db, "Coach"))
+	}
+
+	for round := 0; round < 5; round++ {
+		startAt := time.Now().Add(time.Duration(48+24*round) * time.Hour).Truncate(time.Minute)
+		lessonID, slotID := addTestLesson(t, db, student, startAt)
+		for _, tutorID := range tutors {
+			addTestRequest(t, db, lessonID, tutorID, LessonRequestPending)
+		}
+
+		errs := make([]error, 2)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				_, errs[i] = c.AcceptLesson(lessonID, tutors[i], slotID)
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		winner := -1
+		for i, err := range errs {
+			switch {
+			case err == nil && winner < 0:
+				winner = i
+			case err == nil:
+				t.Fatalf("round %d: both tutors accepted the lesson", round)
+			case !errors.Is(err, ErrLessonTaken):
+				t.Fatalf("round %d: AcceptLesson: %v, want ErrLessonTaken", round, err)
+			}
+		}
+		if winner < 0 {
+			t.Fatalf("round %d: no tutor accepted the lesson: %v", round, errs)
+		}
+
+		var lesson struct {
+			TutorID string `db:"tutor_id"`
+			Status  string `db:"status"`
+		}
+		if err := db.Get(&lesson, "SELECT tutor_id, status FROM lessons WHERE id = $1", lessonID); err != nil {
+			t.Fatal(err)
+		}
+		if lesson.TutorID != tutors[winner] {
+			t.Errorf("round %d: lesson tutor = %s, want %s", round, lesson.TutorID, tutors[winner])
+		}
+		if lesson.Status != LessonAccepted {
+			t.Errorf("round %d: lesson status = %s, want %s", round, lesson.Status, LessonAccepted)
+		}
+
+		var requests []struct {
+			TutorID string `db:"tutor_id"`
+			Status  string `db:"status"`
+		}
+		if err := db.Select(&requests, "SELECT tutor_id, status FROM lesson_requests WHERE lesson_id = $1", lessonID); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range requests {
+			want := LessonRequestClosed
+			if r.TutorID == tutors[winner] {
+				want = LessonRequestAccepted
+			}
+			if r.Status != want {
+				t.Errorf("round %d: request to %s is %s, want %s", round, r.TutorID, r.Status, want)
+			}
+		}
+	}
+}
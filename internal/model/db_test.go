@@ -0,0 +1,140 @@
+package model
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// testDBEnv names the postgres data source, with migrations.sql applied, the
+// database tests run against. They are skipped without it, e.g.
+//
+//	UPFORSCHOOL_TEST_DB="host=127.0.0.1 port=5434 user=postgres password=password dbname=upforschool_test sslmode=disable" go test ./...
+//
+// Every test adds its own rows and removes them when done.
+const testDBEnv = "UPFORSCHOOL_TEST_DB"
+
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDBEnv)
+	if dsn == "" {
+		t.Skip(testDBEnv + " not set")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestID(t *testing.T) string {
+	t.Helper()
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id.String()
+}
+
+// mustExec query or fail the test.
+func mustExec(t *testing.T, db *sqlx.DB, query string, args ...any) {
+	t.Helper()
+
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// addTestUser confirmed, with an email and phone to tell apart.
+func addTestUser(t *testing.T, db *sqlx.DB, firstName string) string {
+	t.Helper()
+
+	id := newTestID(t)
+	mustExec(t, db, `
+	INSERT INTO users (id, first_name, last_name, email, phone, password, status)
+	VALUES ($1, $2, 'Test', $3, $4, '', 'CONFIRMED')`,
+		id, firstName, id+"@example.com", "070"+id[:7])
+
+	t.Cleanup(func() {
+		mustExec(t, db, "DELETE FROM users WHERE id = $1", id)
+	})
+	return id
+}
+
+// addTestTutor for the user.
+func addTestTutor(t *testing.T, db *sqlx.DB, userID string) string {
+	t.Helper()
+
+	id := newTestID(t)
+	mustExec(t, db, `
+	INSERT INTO tutors (id, user_id, first_name, last_name, alias, image, online_lessons)
+	VALUES ($1, $2, 'Test', 'Test', $3, '', TRUE)`,
+		id, userID, "test-"+id)
+
+	t.Cleanup(func() {
+		mustExec(t, db, "DELETE FROM tutors WHERE id = $1", id)
+	})
+	return id
+}
+
+// addTestLesson online for the student at startAt, with a single slot. The
+// lesson uses the first subject, level and location seeded by migrations.sql.
+func addTestLesson(t *testing.T, db *sqlx.DB, studentID string, startAt time.Time) (string, int64) {
+	t.Helper()
+
+	var subjectID, levelID, locationID int
+	query := "SELECT (SELECT MIN(id) FROM subjects), (SELECT MIN(id) FROM levels), (SELECT MIN(id) FROM locations)"
+	if err := db.QueryRow(query).Scan(&subjectID, &levelID, &locationID); err != nil {
+		t.Fatalf("seeded subject, level and location: %v", err)
+	}
+
+	id := newTestID(t)
+	mustExec(t, db, `
+	INSERT INTO lessons (id, student_id, subject_id, level_id, location_id, online_lesson, title, start_at, duration)
+	VALUES ($1, $2, $3, $4, $5, TRUE, 'Test', $6, 60)`,
+		id, studentID, subjectID, levelID, locationID, startAt)
+
+	var slotID int64
+	query = `
+	INSERT INTO lesson_slots (lesson_id, start_at, duration, location_id, online_lesson)
+	VALUES ($1, $2, 60, $3, TRUE)
+	RETURNING id`
+	if err := db.Get(&slotID, query, id, startAt, locationID); err != nil {
+		t.Fatalf("add slot: %v", err)
+	}
+
+	t.Cleanup(func() {
+		mustExec(t, db, "DELETE FROM lesson_status_history WHERE lesson_id = $1", id)
+		mustExec(t, db, "DELETE FROM lesson_requests WHERE lesson_id = $1", id)
+		mustExec(t, db, "DELETE FROM lesson_slots WHERE lesson_id = $1", id)
+		mustExec(t, db, "DELETE FROM lessons WHERE id = $1", id)
+	})
+	return id, slotID
+}
+
+// addTestRequest of the lesson to the tutor with status.
+func addTestRequest(t *testing.T, db *sqlx.DB, lessonID, tutorID, status string) {
+	t.Helper()
+
+	mustExec(t, db, `
+	INSERT INTO lesson_requests (lesson_id, tutor_id, status)
+	VALUES ($1, $2, $3)`,
+		lessonID, tutorID, status)
+}
+
+// setTestLessonTutor as if tutorID accepted the lesson, with the lesson in
+// status.
+func setTestLessonTutor(t *testing.T, db *sqlx.DB, lessonID, tutorID, status string) {
+	t.Helper()
+
+	mustExec(t, db, "UPDATE lessons SET tutor_id = $2, status = $3 WHERE id = $1", lessonID, tutorID, status)
+	mustExec(t, db, "UPDATE lesson_requests SET status = 'ACCEPTED' WHERE lesson_id = $1 AND tutor_id = $2", lessonID, tutorID)
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"database/sql"
 	"time"
+	_ "time/tzdata"
 )
 
 // ContextKey identifier.
@@ -14,6 +15,10 @@ const (
 	ContextKeyTutor   ContextKey = "tutor"
 )
 
+// Timezone lessons are scheduled and shown in. The zone database is embedded
+// with time/tzdata so it loads on hosts without one.
+var Timezone, _ = time.LoadLocation("Europe/Stockholm")
+
 type ActiveRole string
 
 const (
@@ -21,6 +26,26 @@ const (
 	ActiveRoleTutor   ActiveRole = "TUTOR"
 )
 
+// Lesson request statuses.
+const (
+	LessonRequestAwaitingPayment = "AWAITING_PAYMENT"
+	LessonRequestPending         = "PENDING"
+	LessonRequestAccepted        = "ACCEPTED"
+	LessonRequestCancelled       = "CANCELLED"
+	LessonRequestDeclined        = "DECLINED"
+	LessonRequestClosed          = "CLOSED" // another tutor accepted the lesson
+	LessonRequestExpired         = "EXPIRED"
+	LessonRequestApplied         = "APPLIED" // the tutor applied to an open lesson
+)
+
+// Reasons a tutor declines a lesson request.
+const (
+	DeclineReasonBusy     = "BUSY"
+	DeclineReasonSubject  = "SUBJECT"  // not the tutor's subject or level
+	DeclineReasonLocation = "LOCATION" // too far away
+	DeclineReasonOther    = "OTHER"
+)
+
 type Location struct {
 	ID       int    `db:"id" json:"id"`
 	Name     string `db:"name" json:"name"`
@@ -131,21 +156,67 @@ type TutorView struct {
 	BookedStatus string `db:"booked_status"`
 	Selected     bool   // utility field for selection in UI
 
+	// Snippet of the tutor matching a search, see Repository.SearchTutors.
+	Snippet string `db:"snippet"`
+
+	// Rating is the average grade of the tutor's visible ratings.
+	Rating      float64 `db:"rating"`
+	RatingCount int     `db:"rating_count"`
+
+	// ApplicationMessage of a tutor who APPLIED to an open lesson.
+	ApplicationMessage sql.NullString `db:"application_message"`
+
+	// DeclineReason and DeclineMessage of a DECLINED lesson request.
+	DeclineReason  sql.NullString `db:"decline_reason"`
+	DeclineMessage sql.NullString `db:"decline_message"`
+
+	// Available for the proposed lesson times, HasAvailability if the tutor
+	// has said when they are free at all.
+	Available       bool
+	HasAvailability bool
+
 	Subjects []Subject
 	Levels   []Level
 }
 
+// TutorFilter for the tutor directory, zero values don't filter.
+type TutorFilter struct {
+	Online     bool // only tutors giving online lessons
+	LocationID int
+	SubjectID  int
+	LevelID    int
+}
+
+// Search snippet highlighting, around each match.
+const (
+	SnippetStart = "⟦"
+	SnippetStop  = "⟧"
+)
+
+// HideContact clears the tutor's email and phone, which are only shown to
+// students with an accepted lesson with the tutor.
+func (t *TutorView) HideContact() {
+	t.Email = ""
+	t.Phone = ""
+}
+
 type LessonView struct {
 	ID           string         `db:"id"`
 	StudentID    string         `db:"student_id"`
 	StudentName  string         `db:"student_name"`
+	StudentEmail string         `db:"student_email"` // only for tutors with an accepted lesson with the student
+	StudentPhone string         `db:"student_phone"`
 	SubjectID    int            `db:"subject_id"`
 	LevelID      int            `db:"level_id"`
 	LocationID   int            `db:"location_id"`
 	OnlineLesson bool           `db:"online_lesson"`
 	Title        string         `db:"title"`
 	Description  string         `db:"description"`
+	StartAt      time.Time      `db:"start_at"`
+	Duration     int            `db:"duration"` // minutes
 	TutorID      sql.NullString `db:"tutor_id"`
+	SeriesID     sql.NullString `db:"series_id"`
+	IsOpen       bool           `db:"is_open"`
 	CreatedAt    time.Time      `db:"created_at"`
 	UpdatedAt    time.Time      `db:"updated_at"`
 	SubjectName  string         `db:"subject_name"`
@@ -153,12 +224,163 @@ type LessonView struct {
 	LocationName string         `db:"location_name"`
 	BookedStatus string         `db:"booked_status"`
 	AcceptedAt   sql.NullTime   `db:"accepted_at"`
+	Status       string         `db:"status"`
+	CompletedAt  sql.NullTime   `db:"completed_at"`
 	DeletedAt    sql.NullTime   `db:"deleted_at"`
 
-	Tutors []TutorView
+	AwaitingPayment bool `db:"awaiting_payment"`
+	AllDeclined     bool `db:"all_declined"` // every invited tutor declined
+
+	// Grade the student rated the lesson, Rateable if it can still be rated.
+	Grade    sql.NullInt64 `db:"grade"`
+	Rateable bool          `db:"rateable"`
+
+	Tutors  []TutorView
+	Slots   []LessonSlot
+	History []LessonStatusChange
+}
+
+// LessonSlot is a time and place the student proposed for a lesson. Once a
+// tutor accepts one of them the others are released.
+type LessonSlot struct {
+	ID           int64        `db:"id"`
+	LessonID     string       `db:"lesson_id"`
+	StartAt      time.Time    `db:"start_at"`
+	Duration     int          `db:"duration"` // minutes
+	LocationID   int          `db:"location_id"`
+	LocationName string       `db:"location_name"`
+	OnlineLesson bool         `db:"online_lesson"`
+	ReleasedAt   sql.NullTime `db:"released_at"`
+}
+
+// CalendarLesson is an accepted lesson in a user's calendar, AsTutor if the
+// user is its tutor.
+type CalendarLesson struct {
+	ID           string       `db:"id"`
+	Title        string       `db:"title"`
+	Description  string       `db:"description"`
+	SubjectName  string       `db:"subject_name"`
+	LevelName    string       `db:"level_name"`
+	LocationName string       `db:"location_name"`
+	OnlineLesson bool         `db:"online_lesson"`
+	StartAt      time.Time    `db:"start_at"`
+	Duration     int          `db:"duration"` // minutes
+	StudentName  string       `db:"student_name"`
+	TutorName    string       `db:"tutor_name"`
+	AsTutor      bool         `db:"as_tutor"`
+	Sequence     int          `db:"sequence"`
+	UpdatedAt    time.Time    `db:"updated_at"`
+	DeletedAt    sql.NullTime `db:"deleted_at"`
 }
 
 type Profile struct {
 	User    User
 	IsTutor bool
 }
+
+// Order amounts are in minor units (ören), see Money.
+type Order struct {
+	ID              int64          `db:"id"`
+	LessonID        sql.NullString `db:"lesson_id"`
+	DiscountID      sql.NullInt64  `db:"discount_id"`
+	Quantity        int            `db:"quantity"`
+	Amount          int64          `db:"amount"`
+	TaxAmount       int64          `db:"tax_amount"`
+	DiscountAmount  int64          `db:"discount_amount"`
+	ProductName     string         `db:"product_name"`
+	ProductCost     int64          `db:"product_cost"`
+	ProductTax      int64          `db:"product_tax"`
+	ProductCategory string         `db:"product_category"`
+	Currency        string         `db:"currency"`
+	ReferenceUser   string         `db:"reference_user"`
+	ReferenceNumber string         `db:"reference_number"`
+	Status          string         `db:"status"`
+	CreatedAt       time.Time      `db:"created_at"`
+	UpdatedAt       time.Time      `db:"updated_at"`
+}
+
+// Plan price is in minor units (ören), see Money.
+type Plan struct {
+	ID       int64  `db:"id"`
+	Name     string `db:"name"`
+	Role     string `db:"role"`
+	Period   int64  `db:"period"`
+	Interval int64  `db:"interval"`
+	Price    int64  `db:"price"`
+	Tax      int64  `db:"tax"`
+	Currency string `db:"currency"`
+}
+
+// Subscription amounts are in minor units (ören), see Money.
+type Subscription struct {
+	ID             int64        `db:"id"`
+	PlanID         int64        `db:"plan_id"`
+	PlanName       string       `db:"plan_name"`
+	UserID         string       `db:"user_id"`
+	Reference      string       `db:"reference"`
+	Amount         int64        `db:"amount"`
+	TaxAmount      int64        `db:"tax_amount"`
+	DiscountAmount int64        `db:"discount_amount"`
+	Currency       string       `db:"currency"`
+	Period         int64        `db:"period"`
+	Status         string       `db:"status"`
+	ActivatedAt    sql.NullTime `db:"activated_at"`
+	StartsAt       sql.NullTime `db:"starts_at"`
+	EndsAt         sql.NullTime `db:"ends_at"`
+	CreatedAt      time.Time    `db:"created_at"`
+}
+
+// Receipt for a paid order or subscription. Number is the worldline order ID,
+// "O" or "S" followed by the ID. Amounts are in minor units and include VAT.
+type Receipt struct {
+	Number         string    `db:"number"`
+	UserID         string    `db:"user_id"`
+	FirstName      string    `db:"first_name"`
+	LastName       string    `db:"last_name"`
+	Email          string    `db:"email"`
+	ProductName    string    `db:"product_name"`
+	Quantity       int       `db:"quantity"`
+	Price          int64     `db:"price"`
+	TaxRate        int64     `db:"tax_rate"`
+	DiscountAmount int64     `db:"discount_amount"`
+	TaxAmount      int64     `db:"tax_amount"`
+	Amount         int64     `db:"amount"`
+	Currency       string    `db:"currency"`
+	Status         string    `db:"status"`
+	PaidAt         time.Time `db:"paid_at"`
+}
+
+// LedgerLine is a ledger transaction from the tutor's point of view. Amounts
+// are in minor units: what the student paid, the platform's commission, the
+// tutor's share and payouts.
+type LedgerLine struct {
+	ID          int64     `db:"id"`
+	Kind        string    `db:"kind"`
+	Description string    `db:"description"`
+	Paid        int64     `db:"paid"`
+	Commission  int64     `db:"commission"`
+	Earned      int64     `db:"earned"`
+	PaidOut     int64     `db:"paid_out"`
+	Currency    string    `db:"currency"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// RefundNotice for the student of a refunded order.
+type RefundNotice struct {
+	OrderID   int64  `db:"order_id"`
+	FirstName string `db:"first_name"`
+	Email     string `db:"email"`
+	Title     string `db:"title"`
+	Amount    int64  `db:"amount"`
+	Currency  string `db:"currency"`
+}
+
+// SubscriptionReminder for a subscription that is about to end.
+type SubscriptionReminder struct {
+	ID        int64     `db:"id"`
+	UserID    string    `db:"user_id"`
+	FirstName string    `db:"first_name"`
+	Email     string    `db:"email"`
+	PlanName  string    `db:"plan_name"`
+	EndsAt    time.Time `db:"ends_at"`
+}
@@ -0,0 +1,71 @@
+package model
+
+import "fmt"
+
+// Money in minor units (ören for SEK) of Currency. Amounts are integers so
+// sums and comparisons are exact. Rounding only happens in Percent and VAT,
+// always half away from zero to the nearest minor unit.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// String formats m the Swedish way, e.g. "1 249,50 SEK".
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	units := fmt.Sprint(amount / 100)
+	for i := len(units) - 3; i > 0; i -= 3 {
+		units = units[:i] + " " + units[i:]
+	}
+
+	return fmt.Sprintf("%s%s,%02d %s", sign, units, amount%100, m.Currency)
+}
+
+// Decimal amount without grouping or currency, e.g. "1249,50", for
+// spreadsheets.
+func (m Money) Decimal() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d,%02d", sign, amount/100, amount%100)
+}
+
+// Add other to m. Both must have the same currency.
+func (m Money) Add(other Money) Money {
+	return Money{m.Amount + other.Amount, m.Currency}
+}
+
+// Sub other from m. Both must have the same currency.
+func (m Money) Sub(other Money) Money {
+	return Money{m.Amount - other.Amount, m.Currency}
+}
+
+// Percent p of m, rounded half away from zero.
+func (m Money) Percent(p int64) Money {
+	return Money{divRound(m.Amount*p, 100), m.Currency}
+}
+
+// VAT included in the gross amount m at rate percent. The net amount is
+// rounded half away from zero and the VAT is the remainder, so net + VAT is
+// always exactly m.
+func (m Money) VAT(rate int64) Money {
+	net := divRound(m.Amount*100, 100+rate)
+	return Money{m.Amount - net, m.Currency}
+}
+
+// divRound a / b rounded half away from zero, b > 0.
+func divRound(a, b int64) int64 {
+	if a < 0 {
+		return -divRound(-a, b)
+	}
+	return (2*a + b) / (2 * b)
+}
@@ -0,0 +1,141 @@
+package model
+
+import "testing"
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		a, b, want int64
+	}{
+		{0, 7, 0},
+		{4, 10, 0},
+		{5, 10, 1},
+		{14, 10, 1},
+		{15, 10, 2},
+		{16, 10, 2},
+		{-4, 10, 0},
+		{-5, 10, -1},
+		{-15, 10, -2},
+		{-16, 10, -2},
+		{1400, 112, 13},
+		{-1400, 112, -13},
+	}
+
+	for _, tt := range tests {
+		if got := divRound(tt.a, tt.b); got != tt.want {
+			t.Errorf("divRound(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		amount, percent, want int64
+	}{
+		{4900, 0, 0},
+		{4900, 25, 1225},
+		{4900, 100, 4900},
+		{4950, 25, 1238}, // 1237,5
+		{-4950, 25, -1238},
+		{1, 50, 1}, // 0,5
+		{1, 49, 0},
+		{-1, 50, -1},
+		{3, 50, 2}, // 1,5
+		{-3, 50, -2},
+	}
+
+	for _, tt := range tests {
+		got := Money{tt.amount, "SEK"}.Percent(tt.percent)
+		if got != (Money{tt.want, "SEK"}) {
+			t.Errorf("Money{%d}.Percent(%d) = %v, want %d", tt.amount, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyVAT(t *testing.T) {
+	tests := []struct {
+		amount, rate, want int64
+	}{
+		{4900, 25, 980},
+		{9900, 25, 1980},
+		{1, 25, 0},
+		{3, 25, 1}, // net 2,4
+		{-3, 25, -1},
+		{14, 12, 1}, // net 12,5 rounds up to 13
+		{-14, 12, -1},
+		{4900, 0, 0},
+		{0, 25, 0},
+	}
+
+	for _, tt := range tests {
+		m := Money{tt.amount, "SEK"}
+		got := m.VAT(tt.rate)
+		if got != (Money{tt.want, "SEK"}) {
+			t.Errorf("Money{%d}.VAT(%d) = %v, want %d", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateCost(t *testing.T) {
+	tests := []struct {
+		price, percent                   int64
+		wantTotal, wantDiscount, wantTax int64
+	}{
+		{4900, 0, 4900, 0, 980},
+		{4900, 25, 3675, 1225, 735},
+		{4900, 100, 0, 4900, 0},
+		{4950, 0, 4950, 0, 990},
+		{4950, 25, 3712, 1238, 742},
+		{4950, 100, 0, 4950, 0},
+		{9900, 25, 7425, 2475, 1485},
+	}
+
+	for _, tt := range tests {
+		price := Money{tt.price, "SEK"}
+		d := discount{Amount: tt.percent, IsPercent: true}
+		off, err := d.Discount(price)
+		if err != nil {
+			t.Fatalf("Discount(%v): %v", price, err)
+		}
+
+		cost := calculateCost(price, 25, off)
+		want := Cost{
+			Total:    Money{tt.wantTotal, "SEK"},
+			Discount: Money{tt.wantDiscount, "SEK"},
+			Tax:      Money{tt.wantTax, "SEK"},
+		}
+		if cost != want {
+			t.Errorf("calculateCost(%d, 25, %d%%) = %+v, want %+v", tt.price, tt.percent, cost, want)
+		}
+		if cost.Total.Add(cost.Discount) != price {
+			t.Errorf("calculateCost(%d, 25, %d%%): total + discount != price", tt.price, tt.percent)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		amount      int64
+		wantString  string
+		wantDecimal string
+	}{
+		{0, "0,00 SEK", "0,00"},
+		{5, "0,05 SEK", "0,05"},
+		{-5, "-0,05 SEK", "-0,05"},
+		{99, "0,99 SEK", "0,99"},
+		{4900, "49,00 SEK", "49,00"},
+		{100000, "1 000,00 SEK", "1000,00"},
+		{124950, "1 249,50 SEK", "1249,50"},
+		{-124950, "-1 249,50 SEK", "-1249,50"},
+		{123456789, "1 234 567,89 SEK", "1234567,89"},
+	}
+
+	for _, tt := range tests {
+		m := Money{tt.amount, "SEK"}
+		if got := m.String(); got != tt.wantString {
+			t.Errorf("Money{%d}.String() = %q, want %q", tt.amount, got, tt.wantString)
+		}
+		if got := m.Decimal(); got != tt.wantDecimal {
+			t.Errorf("Money{%d}.Decimal() = %q, want %q", tt.amount, got, tt.wantDecimal)
+		}
+	}
+}
@@ -1,5 +0,0 @@
-package service
-
-func (s *Service) ValidateCallback(params string) bool {
-	return s.worldline.Validate(params)
-}
@@ -1,7 +1,13 @@
 package model
 
 import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type Repository struct {
@@ -33,7 +39,7 @@ func (r *Repository) UserByEmail(email string) (*User, error) {
 }
 
 func (r *Repository) Tutor(id string) (*Tutor, error) {
-	query := "SELECT id, user_id, description, image FROM tutors WHERE id = $1"
+	query := "SELECT id, user_id, alias, online_lessons, description, image, created_at, updated_at FROM tutors WHERE id = $1"
 	var t Tutor
 	if err := r.db.Get(&t, query, id); err != nil {
 		return nil, err
@@ -41,6 +47,15 @@ func (r *Repository) Tutor(id string) (*Tutor, error) {
 	return &t, nil
 }
 
+// TutorByAlias with subjects, levels and locations, the alias ignoring case.
+func (r *Repository) TutorByAlias(alias string) (*Tutor, error) {
+	var userID string
+	if err := r.db.Get(&userID, "SELECT user_id FROM tutors WHERE lower(alias) = lower($1)", alias); err != nil {
+		return nil, err
+	}
+	return r.TutorByUserID(userID)
+}
+
 func (r *Repository) TutorByUserID(userID string) (*Tutor, error) {
 	query := "SELECT id, user_id, alias, online_lessons, description, image, updated_at FROM tutors WHERE user_id = $1"
 	var t Tutor
@@ -111,35 +126,144 @@ func (r *Repository) Locations() ([]Location, error) {
 	return result, nil
 }
 
-func (r *Repository) AllTutors() ([]TutorView, error) {
-	query := `
-		SELECT 
+// tutorDirectoryFilter for the confirmed tutors t of users u matching the
+// TutorFilter in $1 to $4.
+const tutorDirectoryFilter = `
+		u.status = 'CONFIRMED'
+		AND (NOT $1 OR t.online_lessons)
+		AND ($2 = 0 OR EXISTS (SELECT 1 FROM tutor_locations AS loc WHERE loc.tutor_id = t.id AND loc.location_id = $2))
+		AND ($3 = 0 OR EXISTS (SELECT 1 FROM tutor_subjects AS s WHERE s.tutor_id = t.id AND s.subject_id = $3))
+		AND ($4 = 0 OR EXISTS (SELECT 1 FROM tutor_levels AS l WHERE l.tutor_id = t.id AND l.level_id = $4))
+	`
+
+// tutorSearchNames of the subjects, levels and locations of tutor t, space
+// separated. "Online" is a location for tutors giving online lessons.
+const tutorSearchNames = `
+			SELECT (SELECT string_agg(sb.name, ' ') FROM tutor_subjects AS ts JOIN subjects AS sb ON sb.id = ts.subject_id WHERE ts.tutor_id = t.id) AS subjects,
+			       (SELECT string_agg(lv.name, ' ') FROM tutor_levels AS tl JOIN levels AS lv ON lv.id = tl.level_id WHERE tl.tutor_id = t.id) AS levels,
+			       concat_ws(' ', CASE WHEN t.online_lessons THEN 'Online' END,
+			                 (SELECT string_agg(lc.name, ' ') FROM tutor_locations AS tc JOIN locations AS lc ON lc.id = tc.location_id WHERE tc.tutor_id = t.id)) AS locations
+	`
+
+// tutorDirectoryColumns of the TutorView in the directory, without contact
+// details.
+const tutorDirectoryColumns = `
 			t.id,
 			t.user_id,
 			t.alias,
 			t.image,
-			t.location_id,
 			t.online_lessons,
-			t.description,
-			first_name,
-			u.last_name,
-			u.email,
-			u.phone,
-			u.sms_opt_in,
-			u.status
+			COALESCE(t.description, '') AS description,
+			t.created_at,
+			t.updated_at,
+			u.status,
+			(SELECT COALESCE(AVG(rt.grade), 0) FROM ratings AS rt WHERE rt.tutor_id = t.id AND rt.hidden_at IS NULL) AS rating,
+			(SELECT COUNT(*) FROM ratings AS rt WHERE rt.tutor_id = t.id AND rt.hidden_at IS NULL) AS rating_count
+	`
+
+// AllTutors for the public directory matching the filter, best rated first,
+// and the number of matching tutors for paging. Contact details are left out.
+func (r *Repository) AllTutors(f TutorFilter, limit, offset int) ([]TutorView, int, error) {
+	where := `
 		FROM users AS u
-		LEFT JOIN tutors AS t ON t.user_id = u.id
-		WHERE u.status = 'CONFIRMED'
+		JOIN tutors AS t ON t.user_id = u.id
+		WHERE ` + tutorDirectoryFilter
+	args := []any{f.Online, f.LocationID, f.SubjectID, f.LevelID}
+
+	var total int
+	if err := r.db.Get(&total, "SELECT COUNT(*)"+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT` + tutorDirectoryColumns + where + `
+		ORDER BY rating DESC, rating_count DESC, t.alias
+		LIMIT $5 OFFSET $6
 	`
 	var result []TutorView
-	if err := r.db.Select(&result, query); err != nil {
-		return nil, err
+	if err := r.db.Select(&result, query, append(args, limit, offset)...); err != nil {
+		return nil, 0, err
 	}
 
-	return result, nil
+	return result, total, nil
+}
+
+// searchTerms for to_tsquery, every word of q as a prefix so "matem" finds
+// "matematik", joined with op, " & " or " | ". Punctuation is dropped so
+// users can't write tsquery syntax.
+func searchTerms(q, op string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, op)
+}
+
+// SearchTutors in the directory for the words in q, in the tutors'
+// search_document (see updateSearchDocument). Tutors matching every word,
+// as a prefix, are found first. If none do, tutors matching any word are.
+// Best matches come first, each with a Snippet where the matches are between
+// SnippetStart and SnippetStop.
+func (r *Repository) SearchTutors(q string, f TutorFilter, limit, offset int) ([]TutorView, int, error) {
+	all := searchTerms(q, " & ")
+	if all == "" {
+		return nil, 0, nil
+	}
+
+	result, total, err := r.searchTutors(all, f, limit, offset)
+	if err != nil || total > 0 {
+		return result, total, err
+	}
+
+	// "matte gymnasiet Uppsala" still finds the tutors in Uppsala.
+	if any := searchTerms(q, " | "); any != all {
+		return r.searchTutors(any, f, limit, offset)
+	}
+	return result, total, nil
 }
 
-func (r *Repository) Tutors(online_lessons bool, locationID, subjectID, levelID int) ([]TutorView, error) {
+// searchTutors matching the to_tsquery terms.
+func (r *Repository) searchTutors(terms string, f TutorFilter, limit, offset int) ([]TutorView, int, error) {
+	where := `
+		FROM users AS u
+		JOIN tutors AS t ON t.user_id = u.id
+		CROSS JOIN to_tsquery('swedish', $5) AS tq
+		WHERE t.search_document @@ tq
+		AND ` + tutorDirectoryFilter
+	args := []any{f.Online, f.LocationID, f.SubjectID, f.LevelID, terms}
+
+	var total int
+	if err := r.db.Get(&total, "SELECT COUNT(*)"+where, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT` + tutorDirectoryColumns + `,
+			ts_headline('swedish', concat_ws(' · ', n.subjects, n.levels, n.locations, t.description), tq,
+			            'StartSel=` + SnippetStart + `, StopSel=` + SnippetStop + `, MinWords=10, MaxWords=30, MaxFragments=2') AS snippet
+		FROM users AS u
+		JOIN tutors AS t ON t.user_id = u.id
+		CROSS JOIN LATERAL (` + tutorSearchNames + `) AS n
+		CROSS JOIN to_tsquery('swedish', $5) AS tq
+		WHERE t.search_document @@ tq
+		AND ` + tutorDirectoryFilter + `
+		ORDER BY ts_rank(t.search_document, tq) DESC, t.alias
+		LIMIT $6 OFFSET $7
+	`
+	var result []TutorView
+	if err := r.db.Select(&result, query, append(args, limit, offset)...); err != nil {
+		return nil, 0, err
+	}
+
+	return result, total, nil
+}
+
+// Tutors matching the lesson requirements. With periods, the proposed lesson
+// times, tutors free for one of them come first, then tutors who haven't set
+// their availability.
+func (r *Repository) Tutors(online_lessons bool, locationID, subjectID, levelID int, at []Period) ([]TutorView, error) {
 	query := `
 		SELECT DISTINCT
 			t.id,
@@ -153,7 +277,9 @@ func (r *Repository) Tutors(online_lessons bool, locationID, subjectID, levelID
 			u.email,
 			u.phone,
 			u.sms_opt_in,
-			u.status
+			u.status,
+			(SELECT COALESCE(AVG(rt.grade), 0) FROM ratings AS rt WHERE rt.tutor_id = t.id AND rt.hidden_at IS NULL) AS rating,
+			(SELECT COUNT(*) FROM ratings AS rt WHERE rt.tutor_id = t.id AND rt.hidden_at IS NULL) AS rating_count
 		FROM users AS u
 		JOIN tutors AS t ON t.user_id = u.id
 		LEFT JOIN tutor_locations loc ON t.id = loc.tutor_id
@@ -170,10 +296,114 @@ func (r *Repository) Tutors(online_lessons bool, locationID, subjectID, levelID
 		return nil, err
 	}
 
+	if len(at) == 0 || len(result) == 0 {
+		return result, nil
+	}
+
+	ids := make([]string, len(result))
+	for i, t := range result {
+		ids[i] = t.ID
+	}
+
+	availability, err := r.tutorsAvailability(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, t := range result {
+		a := availability[t.ID]
+		result[i].HasAvailability = a.IsSet()
+		result[i].Available = a.IsSet() && a.CoversAny(at)
+	}
+
+	rank := func(t TutorView) int {
+		switch {
+		case t.Available:
+			return 0
+		case !t.HasAvailability:
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return rank(result[i]) < rank(result[j])
+	})
+
 	return result, nil
 }
 
-func (r *Repository) SentLessonRequests(userID string) ([]LessonView, error) {
+// TutorAvailability with the weekly slots, upcoming exceptions and booked
+// lessons.
+func (r *Repository) TutorAvailability(tutorID string) (*Availability, error) {
+	availability, err := r.tutorsAvailability([]string{tutorID})
+	if err != nil {
+		return nil, err
+	}
+	return availability[tutorID], nil
+}
+
+// tutorsAvailability by tutor ID, every tutor gets an Availability.
+func (r *Repository) tutorsAvailability(tutorIDs []string) (map[string]*Availability, error) {
+	result := make(map[string]*Availability, len(tutorIDs))
+	for _, id := range tutorIDs {
+		result[id] = &Availability{}
+	}
+
+	var weekly []AvailabilitySlot
+	query := `
+	SELECT id, tutor_id, weekday,
+	       to_char(start_time, 'HH24:MI') AS start_time,
+	       to_char(end_time, 'HH24:MI') AS end_time
+	  FROM tutor_availability
+	 WHERE tutor_id = ANY($1)
+	 ORDER BY weekday, start_time`
+	if err := r.db.Select(&weekly, query, pq.Array(tutorIDs)); err != nil {
+		return nil, err
+	}
+	for _, w := range weekly {
+		result[w.TutorID].Weekly = append(result[w.TutorID].Weekly, w)
+	}
+
+	var exceptions []AvailabilityException
+	query = `
+	SELECT id, tutor_id, to_char(date, 'YYYY-MM-DD') AS date,
+	       to_char(start_time, 'HH24:MI') AS start_time,
+	       to_char(end_time, 'HH24:MI') AS end_time,
+	       available
+	  FROM tutor_availability_exceptions
+	 WHERE tutor_id = ANY($1)
+	   AND date >= CURRENT_DATE - 1
+	 ORDER BY date, start_time`
+	if err := r.db.Select(&exceptions, query, pq.Array(tutorIDs)); err != nil {
+		return nil, err
+	}
+	for _, e := range exceptions {
+		result[e.TutorID].Exceptions = append(result[e.TutorID].Exceptions, e)
+	}
+
+	var booked []struct {
+		TutorID  string    `db:"tutor_id"`
+		StartAt  time.Time `db:"start_at"`
+		Duration int       `db:"duration"`
+	}
+	query = `
+	SELECT tutor_id, start_at, duration
+	  FROM lessons
+	 WHERE tutor_id = ANY($1)
+	   AND deleted_at IS NULL
+	   AND start_at + duration * INTERVAL '1 minute' > CURRENT_TIMESTAMP`
+	if err := r.db.Select(&booked, query, pq.Array(tutorIDs)); err != nil {
+		return nil, err
+	}
+	for _, b := range booked {
+		result[b.TutorID].Booked = append(result[b.TutorID].Booked, Period{Start: b.StartAt, Duration: b.Duration})
+	}
+
+	return result, nil
+}
+
+// SentLessonRequests of the student, the archived ones too if archived.
+func (r *Repository) SentLessonRequests(userID string, archived bool) ([]LessonView, error) {
 
 	var result []LessonView
 	query := `
@@ -187,7 +417,11 @@ func (r *Repository) SentLessonRequests(userID string) ([]LessonView, error) {
 		l.online_lesson as online_lesson,
 		l.title as title,
 		l.description as description,
+		l.start_at as start_at,
+		l.duration as duration,
 		l.tutor_id as tutor_id,
+		l.series_id as series_id,
+		l.is_open as is_open,
 		l.created_at as created_at,
 		l.updated_at as updated_at,
 		s."name" as subject_name,
@@ -195,24 +429,45 @@ func (r *Repository) SentLessonRequests(userID string) ([]LessonView, error) {
 		loc."name" as location_name,
 		COALESCE(req.status, 'PENDING') as booked_status,
 		req.accepted_at as accepted_at,
-		l.deleted_at as deleted_at
+		l.status as status,
+		l.completed_at as completed_at,
+		l.deleted_at as deleted_at,
+		(EXISTS (
+			SELECT 1 FROM lesson_requests AS ar
+			 WHERE ar.lesson_id = l.id AND ar.status = 'AWAITING_PAYMENT'
+		) OR l.is_open AND l.published_at IS NULL) as awaiting_payment,
+		EXISTS (
+			SELECT 1 FROM lesson_requests AS dr
+			 WHERE dr.lesson_id = l.id
+		) AND NOT EXISTS (
+			SELECT 1 FROM lesson_requests AS dr
+			 WHERE dr.lesson_id = l.id AND dr.status != 'DECLINED'
+		) as all_declined,
+		rt.grade as grade,
+		rt.id IS NULL
+		AND l.status IN ('ACCEPTED', 'SCHEDULED', 'COMPLETED')
+		AND l.start_at + l.duration * INTERVAL '1 minute' <= CURRENT_TIMESTAMP as rateable
 	FROM lessons AS l
 		JOIN users AS u ON l.student_id = u.id 
 		JOIN subjects as s on l.subject_id = s.id
 		JOIN levels as lvl on l.level_id = lvl.id 
 		JOIN locations as loc on l.location_id = loc.id 
 		LEFT JOIN lesson_requests as req on l.id = req.lesson_id AND req.status = 'ACCEPTED'
+		LEFT JOIN ratings as rt on rt.lesson_id = l.id
 	WHERE l.student_id = $1 
+	AND ($2 OR l.archived_at IS NULL)
 	ORDER BY l.created_at DESC
 	`
 
-	if err := r.db.Select(&result, query, userID); err != nil {
+	if err := r.db.Select(&result, query, userID, archived); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (r *Repository) ReceivedLessonRequests(tutorID string) ([]LessonView, error) {
+// ReceivedLessonRequests of the tutor, pending or accepted by the tutor, the
+// archived ones too if archived.
+func (r *Repository) ReceivedLessonRequests(tutorID string, archived bool) ([]LessonView, error) {
 	var result []LessonView
 	query := `
 	SELECT 
@@ -225,27 +480,43 @@ func (r *Repository) ReceivedLessonRequests(tutorID string) ([]LessonView, error
 		l.online_lesson as online_lesson,
 		l.title as title,
 		l.description as description,
+		l.start_at as start_at,
+		l.duration as duration,
 		l.tutor_id as tutor_id,
+		l.series_id as series_id,
+		l.is_open as is_open,
 		l.created_at as created_at,
 		l.updated_at as updated_at,
 		s."name" as subject_name,
 		lvl."name" as level_name,
 		loc."name" as location_name,
 		COALESCE(req.status, 'PENDING') as booked_status,
-		req.accepted_at as accepted_at
+		req.accepted_at as accepted_at,
+		l.status as status,
+		l.completed_at as completed_at,
+		CASE WHEN c.shared THEN u.email ELSE '' END as student_email,
+		CASE WHEN c.shared THEN u.phone ELSE '' END as student_phone
 	FROM lessons AS l
+		CROSS JOIN LATERAL (
+			SELECT EXISTS (
+				SELECT 1 FROM lessons AS al
+				 WHERE al.student_id = l.student_id
+				   AND al.tutor_id = $1
+				   AND al.status IN ('ACCEPTED', 'SCHEDULED', 'COMPLETED', 'NO_SHOW')
+			) AS shared
+		) AS c
 		JOIN users AS u ON l.student_id = u.id 
 		JOIN subjects as s on l.subject_id = s.id
 		JOIN levels as lvl on l.level_id = lvl.id 
 		JOIN locations as loc on l.location_id = loc.id 
 		JOIN lesson_requests as req on l.id = req.lesson_id
 	WHERE req.tutor_id = $1
-	AND (req.status = 'PENDING' OR l.tutor_id = $1)
-	AND l.deleted_at IS NULL
+	AND (req.status = 'PENDING' AND l.deleted_at IS NULL OR l.tutor_id = $1)
+	AND ($2 OR l.archived_at IS NULL)
 	ORDER BY l.created_at DESC
 	`
 
-	if err := r.db.Select(&result, query, tutorID); err != nil {
+	if err := r.db.Select(&result, query, tutorID, archived); err != nil {
 		return nil, err
 	}
 	return result, nil
@@ -265,7 +536,11 @@ func (r *Repository) GetLesson(lessonID string) (*LessonView, error) {
 		l.online_lesson as online_lesson,
 		l.title as title,
 		l.description as description,
+		l.start_at as start_at,
+		l.duration as duration,
 		l.tutor_id as tutor_id,
+		l.series_id as series_id,
+		l.is_open as is_open,
 		l.created_at as created_at,
 		l.updated_at as updated_at,
 		s."name" as subject_name,
@@ -273,13 +548,31 @@ func (r *Repository) GetLesson(lessonID string) (*LessonView, error) {
 		loc."name" as location_name,
 		COALESCE(req.status, 'PENDING') as booked_status,
 		req.accepted_at as accepted_at,
-		l.deleted_at as deleted_at
+		l.status as status,
+		l.completed_at as completed_at,
+		l.deleted_at as deleted_at,
+		(EXISTS (
+			SELECT 1 FROM lesson_requests AS ar
+			 WHERE ar.lesson_id = l.id AND ar.status = 'AWAITING_PAYMENT'
+		) OR l.is_open AND l.published_at IS NULL) as awaiting_payment,
+		EXISTS (
+			SELECT 1 FROM lesson_requests AS dr
+			 WHERE dr.lesson_id = l.id
+		) AND NOT EXISTS (
+			SELECT 1 FROM lesson_requests AS dr
+			 WHERE dr.lesson_id = l.id AND dr.status != 'DECLINED'
+		) as all_declined,
+		rt.grade as grade,
+		rt.id IS NULL
+		AND l.status IN ('ACCEPTED', 'SCHEDULED', 'COMPLETED')
+		AND l.start_at + l.duration * INTERVAL '1 minute' <= CURRENT_TIMESTAMP as rateable
 	FROM lessons AS l
 		JOIN users AS u ON l.student_id = u.id 
 		JOIN subjects as s on l.subject_id = s.id
 		JOIN levels as lvl on l.level_id = lvl.id 
 		JOIN locations as loc on l.location_id = loc.id 
 		LEFT JOIN lesson_requests as req on l.id = req.lesson_id AND req.status = 'ACCEPTED'
+		LEFT JOIN ratings as rt on rt.lesson_id = l.id
 	WHERE l.id = $1 
 	`
 
@@ -289,6 +582,41 @@ func (r *Repository) GetLesson(lessonID string) (*LessonView, error) {
 	return &result, nil
 }
 
+// LessonSlots proposed for the lesson that are still open, or the accepted
+// one, earliest first.
+func (r *Repository) LessonSlots(lessonID string) ([]LessonSlot, error) {
+	query := `
+	SELECT s.id, s.lesson_id, s.start_at, s.duration, s.location_id,
+	       loc."name" AS location_name, s.online_lesson, s.released_at
+	  FROM lesson_slots AS s
+	  JOIN locations AS loc ON loc.id = s.location_id
+	 WHERE s.lesson_id = $1
+	   AND s.released_at IS NULL
+	 ORDER BY s.start_at`
+
+	var result []LessonSlot
+	if err := r.db.Select(&result, query, lessonID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LessonSlot by ID.
+func (r *Repository) LessonSlot(id int64) (*LessonSlot, error) {
+	query := `
+	SELECT s.id, s.lesson_id, s.start_at, s.duration, s.location_id,
+	       loc."name" AS location_name, s.online_lesson, s.released_at
+	  FROM lesson_slots AS s
+	  JOIN locations AS loc ON loc.id = s.location_id
+	 WHERE s.id = $1`
+
+	var result LessonSlot
+	if err := r.db.Get(&result, query, id); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (r *Repository) LessonTutors(lessonID string) ([]TutorView, error) {
 	query := `
 		SELECT DISTINCT
@@ -304,7 +632,12 @@ func (r *Repository) LessonTutors(lessonID string) ([]TutorView, error) {
 			u.phone,
 			u.sms_opt_in,
 			u.status,
-			COALESCE(lr.status, 'PENDING') as booked_status
+			(SELECT COALESCE(AVG(rt.grade), 0) FROM ratings AS rt WHERE rt.tutor_id = t.id AND rt.hidden_at IS NULL) AS rating,
+			(SELECT COUNT(*) FROM ratings AS rt WHERE rt.tutor_id = t.id AND rt.hidden_at IS NULL) AS rating_count,
+			COALESCE(lr.status, 'PENDING') as booked_status,
+			lr.message as application_message,
+			lr.decline_reason,
+			lr.decline_message
 		FROM users AS u
 		JOIN tutors AS t ON t.user_id = u.id
 		JOIN lesson_requests lr ON lr.tutor_id = t.id
@@ -319,6 +652,533 @@ func (r *Repository) LessonTutors(lessonID string) ([]TutorView, error) {
 	return result, nil
 }
 
+const calendarLessonQuery = `
+	SELECT l.id, l.title, COALESCE(l.description, '') AS description,
+	       s."name" AS subject_name, lvl."name" AS level_name, loc."name" AS location_name,
+	       l.online_lesson, l.start_at, l.duration,
+	       su.first_name || ' ' || su.last_name AS student_name,
+	       tu.first_name || ' ' || tu.last_name AS tutor_name,
+	       t.user_id = $1 AS as_tutor,
+	       l.sequence, l.updated_at, l.deleted_at
+	  FROM lessons AS l
+	  JOIN subjects AS s ON s.id = l.subject_id
+	  JOIN levels AS lvl ON lvl.id = l.level_id
+	  JOIN locations AS loc ON loc.id = l.location_id
+	  JOIN users AS su ON su.id = l.student_id
+	  JOIN tutors AS t ON t.id = l.tutor_id
+	  JOIN users AS tu ON tu.id = t.user_id
+	 WHERE (l.student_id = $1 OR t.user_id = $1)`
+
+// OpenLessons on the board that the tutor meets the requirements of, the
+// reverse of Tutors, soonest first. Zero subjectID, levelID or locationID
+// don't filter, locationID -1 is online lessons. BookedStatus is APPLIED if
+// the tutor has applied, PENDING if the tutor has been asked and empty
+// otherwise.
+func (r *Repository) OpenLessons(tutorID string, subjectID, levelID, locationID int) ([]LessonView, error) {
+	query := `
+	SELECT 
+		l.id as id,
+		l.student_id as student_id,
+		u.first_name as student_name,
+		l.subject_id as subject_id,
+		l.level_id as level_id,
+		l.location_id as location_id,
+		l.online_lesson as online_lesson,
+		l.title as title,
+		l.description as description,
+		l.start_at as start_at,
+		l.duration as duration,
+		l.series_id as series_id,
+		l.is_open as is_open,
+		l.created_at as created_at,
+		l.updated_at as updated_at,
+		s."name" as subject_name,
+		lvl."name" as level_name,
+		loc."name" as location_name,
+		COALESCE(req.status, '') as booked_status,
+		l.status as status
+	FROM lessons AS l
+		JOIN users AS u ON l.student_id = u.id
+		JOIN subjects as s on l.subject_id = s.id
+		JOIN levels as lvl on l.level_id = lvl.id
+		JOIN locations as loc on l.location_id = loc.id
+		JOIN tutors AS t ON t.id = $1
+		LEFT JOIN lesson_requests as req on l.id = req.lesson_id AND req.tutor_id = t.id
+	WHERE l.is_open
+	AND l.published_at IS NOT NULL
+	AND l.status = 'REQUESTED'
+	AND l.deleted_at IS NULL
+	AND l.start_at > CURRENT_TIMESTAMP
+	AND l.student_id <> t.user_id
+	AND EXISTS (SELECT 1 FROM tutor_subjects AS ts WHERE ts.tutor_id = t.id AND ts.subject_id = l.subject_id)
+	AND EXISTS (SELECT 1 FROM tutor_levels AS tl WHERE tl.tutor_id = t.id AND tl.level_id = l.level_id)
+	AND (l.online_lesson AND t.online_lessons
+	     OR EXISTS (SELECT 1 FROM tutor_locations AS tloc WHERE tloc.tutor_id = t.id AND tloc.location_id = l.location_id))
+	AND ($2 = 0 OR l.subject_id = $2)
+	AND ($3 = 0 OR l.level_id = $3)
+	AND ($4 = 0 OR l.location_id = $4)
+	ORDER BY l.start_at
+	`
+
+	var result []LessonView
+	if err := r.db.Select(&result, query, tutorID, subjectID, levelID, locationID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LessonStatusHistory of the lesson, oldest first.
+func (r *Repository) LessonStatusHistory(lessonID string) ([]LessonStatusChange, error) {
+	query := `
+	SELECT h.from_status, h.to_status, h.user_id,
+	       u.first_name || ' ' || u.last_name AS user_name,
+	       h.created_at
+	  FROM lesson_status_history AS h
+	  LEFT JOIN users AS u ON u.id = h.user_id
+	 WHERE h.lesson_id = $1
+	 ORDER BY h.created_at, h.id`
+
+	var result []LessonStatusChange
+	if err := r.db.Select(&result, query, lessonID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TutorRatings of the tutor, newest first, the hidden ones too if hidden.
+func (r *Repository) TutorRatings(tutorID string, hidden bool) ([]Rating, error) {
+	query := `
+	SELECT rt.id, rt.lesson_id, rt.tutor_id, rt.grade, rt.feedback,
+	       rt.reply, rt.replied_at, rt.hidden_at, rt.created_at,
+	       u.first_name AS student_name,
+	       l.title AS lesson_title
+	  FROM ratings AS rt
+	  JOIN lessons AS l ON l.id = rt.lesson_id
+	  JOIN users AS u ON u.id = l.student_id
+	 WHERE rt.tutor_id = $1
+	   AND ($2 OR rt.hidden_at IS NULL)
+	 ORDER BY rt.created_at DESC`
+
+	var result []Rating
+	if err := r.db.Select(&result, query, tutorID, hidden); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TutorRating is the average grade and number of the tutor's visible
+// ratings.
+func (r *Repository) TutorRating(tutorID string) (float64, int, error) {
+	query := `
+	SELECT COALESCE(AVG(grade), 0), COUNT(*)
+	  FROM ratings
+	 WHERE tutor_id = $1
+	   AND hidden_at IS NULL`
+
+	var avg float64
+	var count int
+	if err := r.db.QueryRow(query, tutorID).Scan(&avg, &count); err != nil {
+		return 0, 0, err
+	}
+	return avg, count, nil
+}
+
+// ContactTutors that have accepted a lesson of the student, not cancelled,
+// whose email and phone the student may see.
+func (r *Repository) ContactTutors(studentID string) (map[string]bool, error) {
+	query := `
+	SELECT DISTINCT tutor_id
+	  FROM lessons
+	 WHERE student_id = $1
+	   AND tutor_id IS NOT NULL
+	   AND status IN ('ACCEPTED', 'SCHEDULED', 'COMPLETED', 'NO_SHOW')`
+
+	var ids []string
+	if err := r.db.Select(&ids, query, studentID); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result, nil
+}
+
+const messageThreadQuery = `
+	SELECT l.id AS lesson_id, l.title AS lesson_title,
+	       t.id AS tutor_id, t.user_id AS tutor_user_id, t.alias AS tutor_alias,
+	       l.student_id, su.first_name AS student_name,
+	       m.body AS last_message, m.created_at AS last_message_at,
+	       (SELECT COUNT(*) FROM lesson_messages AS um
+	         WHERE um.lesson_id = l.id AND um.tutor_id = t.id
+	           AND um.recipient_id = $1 AND um.read_at IS NULL) AS unread,
+	       lr.status IN ('PENDING', 'ACCEPTED', 'APPLIED') AS open
+	  FROM lesson_requests AS lr
+	  JOIN lessons AS l ON l.id = lr.lesson_id
+	  JOIN tutors AS t ON t.id = lr.tutor_id
+	  JOIN users AS su ON su.id = l.student_id
+	  LEFT JOIN LATERAL (
+	       SELECT body, created_at
+	         FROM lesson_messages
+	        WHERE lesson_id = l.id AND tutor_id = t.id
+	        ORDER BY created_at DESC, id DESC
+	        LIMIT 1) AS m ON TRUE`
+
+// MessageThread of the lesson with the tutor, unread counted for userID.
+// Requests waiting for payment have no thread.
+func (r *Repository) MessageThread(lessonID, tutorID, userID string) (*MessageThread, error) {
+	query := messageThreadQuery + `
+	 WHERE lr.lesson_id = $2
+	   AND lr.tutor_id = $3
+	   AND lr.status != 'AWAITING_PAYMENT'`
+
+	var result MessageThread
+	if err := r.db.Get(&result, query, userID, lessonID, tutorID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MessageThreads of the user as student or tutor that have messages, latest
+// first.
+func (r *Repository) MessageThreads(userID string) ([]MessageThread, error) {
+	query := messageThreadQuery + `
+	 WHERE (l.student_id = $1 OR t.user_id = $1)
+	   AND m.created_at IS NOT NULL
+	 ORDER BY m.created_at DESC`
+
+	var result []MessageThread
+	if err := r.db.Select(&result, query, userID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ThreadMessages of the lesson with the tutor, oldest first.
+func (r *Repository) ThreadMessages(lessonID, tutorID string) ([]Message, error) {
+	query := `
+	SELECT m.id, m.lesson_id, m.tutor_id, m.sender_id, m.recipient_id,
+	       u.first_name AS sender_name, m.body, m.read_at, m.created_at
+	  FROM lesson_messages AS m
+	  JOIN users AS u ON u.id = m.sender_id
+	 WHERE m.lesson_id = $1
+	   AND m.tutor_id = $2
+	 ORDER BY m.created_at, m.id`
+
+	var result []Message
+	if err := r.db.Select(&result, query, lessonID, tutorID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnreadMessages to the user.
+func (r *Repository) UnreadMessages(userID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM lesson_messages WHERE recipient_id = $1 AND read_at IS NULL`
+	if err := r.db.QueryRow(query, userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CalendarLessons of the user as student or tutor for the calendar feed,
+// the last three months and onwards. Lessons cancelled the last month are
+// included so calendars remove them.
+func (r *Repository) CalendarLessons(userID string) ([]CalendarLesson, error) {
+	query := calendarLessonQuery + `
+	   AND l.start_at > CURRENT_TIMESTAMP - INTERVAL '3 months'
+	   AND (l.deleted_at IS NULL OR l.deleted_at > CURRENT_TIMESTAMP - INTERVAL '1 month')
+	 ORDER BY l.start_at`
+
+	var result []CalendarLesson
+	if err := r.db.Select(&result, query, userID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CalendarLesson by ID if the user is its student or tutor and it has been
+// accepted.
+func (r *Repository) CalendarLesson(userID, lessonID string) (*CalendarLesson, error) {
+	query := calendarLessonQuery + `
+	   AND l.id = $2`
+
+	var result CalendarLesson
+	if err := r.db.Get(&result, query, userID, lessonID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UserByCalendarToken for the calendar feed.
+func (r *Repository) UserByCalendarToken(token string) (*User, error) {
+	query := "SELECT id, first_name, last_name, email, phone, sms_opt_in, status, active_role, is_admin FROM users WHERE calendar_token = $1"
+	var u User
+	if err := r.db.Get(&u, query, token); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *Repository) Order(id int64) (*Order, error) {
+	query := `
+	SELECT id, lesson_id, discount_id, quantity, amount, tax_amount, discount_amount,
+	       product_name, product_cost, product_tax, product_category, currency,
+	       reference_user, reference_number, status, created_at, updated_at
+	  FROM orders
+	 WHERE id = $1`
+
+	var o Order
+	if err := r.db.Get(&o, query, id); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// LessonOrder returns the latest order for a lesson.
+func (r *Repository) LessonOrder(lessonID string) (*Order, error) {
+	query := `
+	SELECT id, lesson_id, discount_id, quantity, amount, tax_amount, discount_amount,
+	       product_name, product_cost, product_tax, product_category, currency,
+	       reference_user, reference_number, status, created_at, updated_at
+	  FROM orders
+	 WHERE lesson_id = $1
+	 ORDER BY created_at DESC
+	 LIMIT 1`
+
+	var o Order
+	if err := r.db.Get(&o, query, lessonID); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *Repository) Subscription(id int64) (*Subscription, error) {
+	query := `
+	SELECT s.id, s.plan_id, p.name AS plan_name, s.user_id, s.reference, s.amount, s.tax_amount,
+	       s.discount_amount, p.currency, p.period, s.status, s.activated_at, s.starts_at, s.ends_at, s.created_at
+	  FROM subscriptions AS s
+	  JOIN plans AS p ON s.plan_id = p.id
+	 WHERE s.id = $1`
+
+	var s Subscription
+	if err := r.db.Get(&s, query, id); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ActiveSubscription returns the subscription covering the current time.
+func (r *Repository) ActiveSubscription(userID string) (*Subscription, error) {
+	query := `
+	SELECT s.id, s.plan_id, p.name AS plan_name, s.user_id, s.reference, s.amount, s.tax_amount,
+	       s.discount_amount, p.currency, p.period, s.status, s.activated_at, s.starts_at, s.ends_at, s.created_at
+	  FROM subscriptions AS s
+	  JOIN plans AS p ON s.plan_id = p.id
+	 WHERE s.user_id = $1
+	   AND s.activated_at IS NOT NULL
+	   AND s.starts_at <= CURRENT_TIMESTAMP
+	   AND s.ends_at > CURRENT_TIMESTAMP
+	 ORDER BY s.ends_at DESC
+	 LIMIT 1`
+
+	var s Subscription
+	if err := r.db.Get(&s, query, userID); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Plans returns the active plans for role.
+func (r *Repository) Plans(role ActiveRole) ([]Plan, error) {
+	query := `
+	SELECT id, name, COALESCE(role, '') AS role, period, interval, price, tax, currency
+	  FROM plans
+	 WHERE active
+	   AND (role IS NULL OR role = $1)
+	 ORDER BY price`
+
+	var result []Plan
+	if err := r.db.Select(&result, query, role); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExpiringSubscriptions returns activated subscriptions ending within days
+// that have not been renewed or reminded about.
+func (r *Repository) ExpiringSubscriptions(days int) ([]SubscriptionReminder, error) {
+	query := `
+	SELECT s.id, s.user_id, u.first_name, u.email, p.name AS plan_name, s.ends_at
+	  FROM subscriptions AS s
+	  JOIN plans AS p ON s.plan_id = p.id
+	  JOIN users AS u ON s.user_id = u.id
+	 WHERE s.activated_at IS NOT NULL
+	   AND s.reminded_at IS NULL
+	   AND s.ends_at > CURRENT_TIMESTAMP
+	   AND s.ends_at <= CURRENT_TIMESTAMP + interval '1 day' * $1
+	   AND NOT EXISTS (
+	       SELECT 1
+	         FROM subscriptions AS renewal
+	        WHERE renewal.user_id = s.user_id
+	          AND renewal.activated_at IS NOT NULL
+	          AND renewal.ends_at > s.ends_at)`
+
+	var result []SubscriptionReminder
+	if err := r.db.Select(&result, query, days); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnacceptedOrders returns paid lesson orders no tutor has accepted within
+// days of the payment. Orders whose lesson still has open requests are left
+// until the lesson starts, the requests may yet be accepted.
+func (r *Repository) UnacceptedOrders(days int) ([]int64, error) {
+	query := `
+	SELECT o.id
+	  FROM orders AS o
+	  JOIN lessons AS l ON o.lesson_id = l.id
+	  JOIN LATERAL (
+	       SELECT MAX(pe.created_at) AS paid_at
+	         FROM payment_events AS pe
+	        WHERE pe.order_id = o.id) AS p ON TRUE
+	 WHERE o.status = 'COMPLETED'
+	   AND o.amount > 0
+	   AND p.paid_at <= CURRENT_TIMESTAMP - interval '1 day' * $1
+	   AND l.deleted_at IS NULL
+	   AND NOT EXISTS (
+	       SELECT 1
+	         FROM lesson_requests AS lr
+	        WHERE lr.lesson_id = l.id
+	          AND lr.status = 'ACCEPTED')
+	   AND (l.start_at <= CURRENT_TIMESTAMP
+	        OR NOT EXISTS (
+	           SELECT 1
+	             FROM lesson_requests AS lr
+	            WHERE lr.lesson_id = l.id
+	              AND lr.status IN ('PENDING', 'APPLIED')))`
+
+	var result []int64
+	if err := r.db.Select(&result, query, days); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RefundNotice for the student who paid order id.
+func (r *Repository) RefundNotice(id int64) (*RefundNotice, error) {
+	query := `
+	SELECT o.id AS order_id, u.first_name, u.email, l.title, o.amount, o.currency
+	  FROM orders AS o
+	  JOIN lessons AS l ON o.lesson_id = l.id
+	  JOIN users AS u ON l.student_id = u.id
+	 WHERE o.id = $1`
+
+	var n RefundNotice
+	if err := r.db.Get(&n, query, id); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+const orderReceiptQuery = `
+	SELECT 'O' || o.id AS number, l.student_id AS user_id, u.first_name, u.last_name, u.email,
+	       o.product_name, o.quantity, o.product_cost AS price, o.product_tax AS tax_rate,
+	       o.discount_amount, o.tax_amount, o.amount, o.currency, o.status, o.updated_at AS paid_at
+	  FROM orders AS o
+	  JOIN lessons AS l ON o.lesson_id = l.id
+	  JOIN users AS u ON l.student_id = u.id
+	 WHERE o.status IN ('COMPLETED', 'REFUNDING', 'REFUNDED')`
+
+const subscriptionReceiptQuery = `
+	SELECT 'S' || s.id AS number, s.user_id, u.first_name, u.last_name, u.email,
+	       p.name AS product_name, 1 AS quantity, p.price, p.tax AS tax_rate,
+	       s.discount_amount, s.tax_amount, s.amount, p.currency, s.status, s.updated_at AS paid_at
+	  FROM subscriptions AS s
+	  JOIN plans AS p ON s.plan_id = p.id
+	  JOIN users AS u ON s.user_id = u.id
+	 WHERE s.status IN ('COMPLETED', 'REFUNDED')`
+
+// OrderReceipt for a completed order.
+func (r *Repository) OrderReceipt(id int64) (*Receipt, error) {
+	var result Receipt
+	if err := r.db.Get(&result, orderReceiptQuery+" AND o.id = $1", id); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SubscriptionReceipt for a completed subscription.
+func (r *Repository) SubscriptionReceipt(id int64) (*Receipt, error) {
+	var result Receipt
+	if err := r.db.Get(&result, subscriptionReceiptQuery+" AND s.id = $1", id); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Receipts for all of the user's completed orders and subscriptions, newest
+// first.
+func (r *Repository) Receipts(userID string) ([]Receipt, error) {
+	query := orderReceiptQuery + " AND l.student_id = $1" +
+		" UNION ALL " + subscriptionReceiptQuery + " AND s.user_id = $1" +
+		" ORDER BY paid_at DESC"
+
+	var result []Receipt
+	if err := r.db.Select(&result, query, userID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TutorLedger returns the tutor's ledger transactions in year, oldest first.
+func (r *Repository) TutorLedger(tutorID string, year int) ([]LedgerLine, error) {
+	query := `
+	SELECT t.id,
+	       t.kind,
+	       COALESCE(l.title, t.reference) AS description,
+	       COALESCE(SUM(e.amount) FILTER (WHERE e.account = 'PAYMENTS'), 0) AS paid,
+	       COALESCE(-SUM(e.amount) FILTER (WHERE e.account = 'COMMISSION'), 0) AS commission,
+	       COALESCE(-SUM(e.amount) FILTER (WHERE e.account = 'TUTOR_PAYABLE' AND t.kind = 'LESSON'), 0) AS earned,
+	       COALESCE(SUM(e.amount) FILTER (WHERE e.account = 'TUTOR_PAYABLE' AND t.kind = 'PAYOUT'), 0) AS paid_out,
+	       MIN(e.currency) AS currency,
+	       t.created_at
+	  FROM ledger_transactions AS t
+	  JOIN ledger_entries AS e ON e.transaction_id = t.id
+	  LEFT JOIN lessons AS l ON t.lesson_id = l.id
+	 WHERE t.tutor_id = $1
+	   AND t.created_at >= make_date($2, 1, 1)
+	   AND t.created_at < make_date($2 + 1, 1, 1)
+	 GROUP BY t.id, l.title
+	 ORDER BY t.created_at`
+
+	var result []LedgerLine
+	if err := r.db.Select(&result, query, tutorID, year); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TutorBalance is what the platform owes the tutor, per currency.
+func (r *Repository) TutorBalance(tutorID string) ([]Money, error) {
+	query := `
+	SELECT -SUM(amount) AS amount, currency
+	  FROM ledger_entries
+	 WHERE tutor_id = $1
+	   AND account = 'TUTOR_PAYABLE'
+	 GROUP BY currency
+	 ORDER BY currency`
+
+	var result []Money
+	if err := r.db.Select(&result, query, tutorID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // func (c *Core) ReceivedLessonRequests(userID string) (string, error) {
 
 // }
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+// TestContactTutors only has the tutors with an accepted lesson, the student
+// sees their contact details.
+func TestContactTutors(t *testing.T) {
+	db := testDB(t)
+	r := NewRepository(db)
+
+	student := addTestUser(t, db, "Elev")
+	accepted := addTestTutor(t, db, addTestUser(t, db, "Coach"))
+	asked := addTestTutor(t, db, addTestUser(t, db, "Coach"))
+	cancelled := addTestTutor(t, db, addTestUser(t, db, "Coach"))
+
+	startAt := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+	lesson, _ := addTestLesson(t, db, student, startAt)
+	addTestRequest(t, db, lesson, accepted, LessonRequestPending)
+	addTestRequest(t, db, lesson, asked, LessonRequestPending)
+
+	contacts, err := r.ContactTutors(student)
+	if err != nil {
+		t.Fatalf("ContactTutors: %v", err)
+	}
+	if len(contacts) != 0 {
+		t.Errorf("ContactTutors before any accepted lesson = %v, want none", contacts)
+	}
+
+	setTestLessonTutor(t, db, lesson, accepted, LessonScheduled)
+
+	other, _ := addTestLesson(t, db, student, startAt.Add(24*time.Hour))
+	addTestRequest(t, db, other, cancelled, LessonRequestPending)
+	setTestLessonTutor(t, db, other, cancelled, LessonCancelledByTutor)
+
+	contacts, err = r.ContactTutors(student)
+	if err != nil {
+		t.Fatalf("ContactTutors: %v", err)
+	}
+	if !contacts[accepted] {
+		t.Error("ContactTutors is missing the tutor with a scheduled lesson")
+	}
+	if contacts[asked] {
+		t.Error("ContactTutors has a tutor only asked for the lesson")
+	}
+	if contacts[cancelled] {
+		t.Error("ContactTutors has a tutor whose lesson was cancelled")
+	}
+}
+
+// TestReceivedLessonRequestsContact only shows the student's contact details
+// to a tutor once they share an accepted lesson, on all the student's
+// requests to that tutor.
+func TestReceivedLessonRequestsContact(t *testing.T) {
+	db := testDB(t)
+	r := NewRepository(db)
+
+	student := addTestUser(t, db, "Elev")
+	tutor := addTestTutor(t, db, addTestUser(t, db, "Coach"))
+	other := addTestTutor(t, db, addTestUser(t, db, "Coach"))
+
+	var email, phone string
+	if err := db.QueryRow("SELECT email, phone FROM users WHERE id = $1", student).Scan(&email, &phone); err != nil {
+		t.Fatal(err)
+	}
+
+	startAt := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+	first, _ := addTestLesson(t, db, student, startAt)
+	addTestRequest(t, db, first, tutor, LessonRequestPending)
+	addTestRequest(t, db, first, other, LessonRequestPending)
+
+	lessons, err := r.ReceivedLessonRequests(tutor, false)
+	if err != nil {
+		t.Fatalf("ReceivedLessonRequests: %v", err)
+	}
+	if len(lessons) != 1 {
+		t.Fatalf("got %d lessons, want 1", len(lessons))
+	}
+	if lessons[0].StudentEmail != "" || lessons[0].StudentPhone != "" {
+		t.Errorf("pending request shows contact %q %q, want none", lessons[0].StudentEmail, lessons[0].StudentPhone)
+	}
+
+	second, _ := addTestLesson(t, db, student, startAt.Add(24*time.Hour))
+	addTestRequest(t, db, second, tutor, LessonRequestPending)
+	setTestLessonTutor(t, db, second, tutor, LessonAccepted)
+
+	lessons, err = r.ReceivedLessonRequests(tutor, false)
+	if err != nil {
+		t.Fatalf("ReceivedLessonRequests: %v", err)
+	}
+	if len(lessons) != 2 {
+		t.Fatalf("got %d lessons, want 2", len(lessons))
+	}
+	for _, l := range lessons {
+		if l.StudentEmail != email || l.StudentPhone != phone {
+			t.Errorf("lesson %s shows contact %q %q, want %q %q", l.ID, l.StudentEmail, l.StudentPhone, email, phone)
+		}
+	}
+
+	lessons, err = r.ReceivedLessonRequests(other, false)
+	if err != nil {
+		t.Fatalf("ReceivedLessonRequests: %v", err)
+	}
+	for _, l := range lessons {
+		if l.StudentEmail != "" || l.StudentPhone != "" {
+			t.Errorf("other tutor sees contact %q %q, want none", l.StudentEmail, l.StudentPhone)
+		}
+	}
+}
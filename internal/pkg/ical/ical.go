@@ -0,0 +1,120 @@
+// Package ical writes iCalendar (RFC 5545) files, enough for calendar feeds
+// and single event downloads of lessons.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType of iCalendar files.
+const ContentType = "text/calendar; charset=utf-8"
+
+// Event in a calendar. Times are written in UTC.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	Modified    time.Time
+
+	// Sequence is increased every time the event changes, so calendars
+	// replace their copy.
+	Sequence  int
+	Cancelled bool
+}
+
+// Calendar of events, named Name in the user's calendar app.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Bytes of the calendar as an .ics file.
+func (c *Calendar) Bytes() []byte {
+	var b bytes.Buffer
+	line := func(name, value string) {
+		fold(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Up For School//Lektioner//SV")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	stamp := utc(time.Now())
+	for _, e := range c.Events {
+		status := "CONFIRMED"
+		if e.Cancelled {
+			status = "CANCELLED"
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", stamp)
+		line("DTSTART", utc(e.Start))
+		line("DTEND", utc(e.End))
+		if !e.Modified.IsZero() {
+			line("LAST-MODIFIED", utc(e.Modified))
+		}
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		line("STATUS", status)
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return b.Bytes()
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escape TEXT values.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// fold content lines longer than 75 octets, without splitting characters,
+// and end them with CRLF.
+func fold(b *bytes.Buffer, s string) {
+	limit := 75
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i])
+		b.WriteString("\r\n ")
+		s = s[i:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,310 @@
+package worldline
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// currencyCodes in ISO 4217 numeric form, as sent in callbacks.
+var currencyCodes = map[string]string{
+	SEK: "752",
+	EUR: "978",
+	USD: "840",
+}
+
+// FakeServer imitates the worldline/bambora checkout for local development
+// and integration tests. It accepts session creation on /sessions, renders a
+// pay / cancel page, fires md5 signed callbacks like the real checkout and
+// credits paid transactions on /transactions/{txnid}/credit.
+//
+//	fake := worldline.NewFakeServer(md5key)
+//	http.ListenAndServe(":8081", fake)
+//
+// and set the worldline APIURL to http://localhost:8081/sessions and
+// TransactionURL to http://localhost:8081.
+type FakeServer struct {
+	md5Key string
+	client *http.Client
+	router *http.ServeMux
+
+	mu       sync.Mutex
+	sessions map[string]*fakeSession
+	// transactions maps paid txnid to the amount left to credit.
+	transactions map[string]int64
+}
+
+type fakeSession struct {
+	data      data
+	expiresAt time.Time
+}
+
+// NewFakeServer signing callbacks with md5key.
+func NewFakeServer(md5key string) *FakeServer {
+	f := &FakeServer{
+		md5Key:       md5key,
+		sessions:     make(map[string]*fakeSession),
+		transactions: make(map[string]int64),
+		client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+
+	f.router = http.NewServeMux()
+	f.router.HandleFunc("POST /sessions", f.handleCreateSession)
+	f.router.HandleFunc("GET /pay/{token}", f.handlePage)
+	f.router.HandleFunc("POST /pay/{token}/accept", f.handleAccept)
+	f.router.HandleFunc("POST /pay/{token}/cancel", f.handleCancel)
+	f.router.HandleFunc("POST /transactions/{txnid}/credit", f.handleCredit)
+
+	return f
+}
+
+func (f *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.router.ServeHTTP(w, r)
+}
+
+func (f *FakeServer) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok {
+		http.Error(w, "missing credentials", http.StatusUnauthorized)
+		return
+	}
+
+	var d data
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case d.Order.ID == "":
+		http.Error(w, "missing order id", http.StatusBadRequest)
+		return
+	case d.Order.Amount <= 0:
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	case currencyCodes[d.Order.Currency] == "":
+		http.Error(w, "invalid currency", http.StatusBadRequest)
+		return
+	case d.URL.Accept == "" || d.URL.Cancel == "" || len(d.URL.Callbacks) == 0:
+		http.Error(w, "missing urls", http.StatusBadRequest)
+		return
+	}
+
+	token, err := randomHex(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f.mu.Lock()
+	f.sessions[token] = &fakeSession{
+		data:      d,
+		expiresAt: time.Now().Add(time.Hour),
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session{
+		Token: token,
+		URL:   "http://" + r.Host + "/pay/" + token,
+	})
+}
+
+var fakePage = template.Must(template.New("pay").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Fake checkout</title></head>
+<body>
+  <h1>Fake checkout</h1>
+  <p>Order {{.ID}}: {{.Amount}} {{.Currency}}</p>
+  <form method="post" action="/pay/{{.Token}}/accept"><button type="submit">Pay</button></form>
+  <form method="post" action="/pay/{{.Token}}/cancel"><button type="submit">Cancel</button></form>
+</body>
+</html>`))
+
+func (f *FakeServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+	s, ok := f.session(token, false)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := fakePage.Execute(w, map[string]any{
+		"Token":    token,
+		"ID":       s.data.Order.ID,
+		"Amount":   fmt.Sprintf("%d.%02d", s.data.Order.Amount/100, s.data.Order.Amount%100),
+		"Currency": s.data.Order.Currency,
+	})
+	if err != nil {
+		log.Printf("worldline fake: %v", err)
+	}
+}
+
+// handleAccept fires the callbacks and redirects to the accept URL with the
+// same signed params, the way the real checkout does.
+func (f *FakeServer) handleAccept(w http.ResponseWriter, r *http.Request) {
+	s, ok := f.session(r.PathValue("token"), true)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	txnID, err := randomDigits(18)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f.mu.Lock()
+	f.transactions[txnID] = s.data.Order.Amount
+	f.mu.Unlock()
+
+	query := f.signedQuery(txnID, s.data.Order)
+
+	for _, cb := range s.data.URL.Callbacks {
+		res, err := f.client.Get(withQuery(cb.URL, query))
+		if err != nil {
+			log.Printf("worldline fake: callback %s: %v", cb.URL, err)
+			continue
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			log.Printf("worldline fake: callback %s: %s", cb.URL, res.Status)
+		}
+	}
+
+	http.Redirect(w, r, withQuery(s.data.URL.Accept, query), http.StatusFound)
+}
+
+func (f *FakeServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	s, ok := f.session(r.PathValue("token"), true)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, s.data.URL.Cancel, http.StatusFound)
+}
+
+func (f *FakeServer) handleCredit(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok {
+		http.Error(w, "missing credentials", http.StatusUnauthorized)
+		return
+	}
+
+	var c credit
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var res creditResponse
+	res.Meta.Result = true
+
+	f.mu.Lock()
+	left, ok := f.transactions[r.PathValue("txnid")]
+	switch {
+	case !ok:
+		res.Meta.Result = false
+		res.Meta.Message.Merchant = "transaction not found"
+	case c.Amount <= 0 || c.Amount > left:
+		res.Meta.Result = false
+		res.Meta.Message.Merchant = "invalid credit amount"
+	default:
+		f.transactions[r.PathValue("txnid")] = left - c.Amount
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// session by token, removing it if remove is set. Expired sessions are not
+// returned.
+func (f *FakeServer) session(token string, remove bool) (*fakeSession, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.sessions[token]
+	if !ok {
+		return nil, false
+	}
+
+	if remove || time.Now().After(s.expiresAt) {
+		delete(f.sessions, token)
+	}
+
+	if time.Now().After(s.expiresAt) {
+		return nil, false
+	}
+
+	return s, true
+}
+
+// signedQuery for order. The hash is md5(values + md5key) over the params in
+// order, see Validate.
+func (f *FakeServer) signedQuery(txnID string, o order) string {
+	now := time.Now()
+	params := [][2]string{
+		{"txnid", txnID},
+		{"orderid", o.ID},
+		{"reference", txnID},
+		{"amount", fmt.Sprint(o.Amount)},
+		{"currency", currencyCodes[o.Currency]},
+		{"date", now.Format("20060102")},
+		{"time", now.Format("1504")},
+		{"feeid", "0"},
+		{"txnfee", "0"},
+		{"paymenttype", "1"},
+		{"cardno", "444444XXXXXX4000"},
+	}
+
+	var values string
+	parts := make([]string, 0, len(params)+1)
+	for _, p := range params {
+		v := neturl.QueryEscape(p[1])
+		values += v
+		parts = append(parts, p[0]+"="+v)
+	}
+	parts = append(parts, "hash="+md5Hash([]byte(values+f.md5Key)))
+
+	return strings.Join(parts, "&")
+}
+
+func withQuery(rawURL, query string) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query
+	}
+	return rawURL + "?" + query
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomDigits(n int) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(d.String())
+	}
+	return sb.String(), nil
+}
@@ -22,12 +22,13 @@ const (
 )
 
 type Worldline struct {
-	apiURL   string
-	appURL   string
-	username string
-	password string
-	md5Key   string
-	client   *http.Client
+	apiURL         string
+	transactionURL string
+	appURL         string
+	username       string
+	password       string
+	md5Key         string
+	client         *http.Client
 }
 
 type OrderCreate struct {
@@ -80,33 +81,31 @@ type session struct {
 	URL   string `json:"url"`
 }
 
-func (w *Worldline) NewSubscription(orderID int64, amount float64, currency Currency) OrderCreate {
-	amountInCents := int64(amount * 100)
-
+// NewSubscription for amount in minor units (ören).
+func (w *Worldline) NewSubscription(orderID int64, amount int64, currency Currency) OrderCreate {
 	// subscriptions are prefixed with "S".
 	id := fmt.Sprintf("S%d", orderID)
 	return OrderCreate{
 		OrderID:     id,
 		Currency:    currency,
-		Amount:      amountInCents,
-		AcceptURL:   w.appURL + "/organizations/subscriptions/accept",
-		CancelURL:   w.appURL + "/organizations/subscriptions",
-		CallbackURL: w.appURL + "/organizations/subscriptions/callback",
+		Amount:      amount,
+		AcceptURL:   w.appURL + "/subscriptions/accept",
+		CancelURL:   w.appURL + "/subscriptions/cancel",
+		CallbackURL: w.appURL + "/subscriptions/callback",
 	}
 }
 
-func (w *Worldline) NewOrder(orderID int64, amount float64, currency Currency) OrderCreate {
-	amountInCents := int64(amount * 100)
-
+// NewOrder for amount in minor units (ören).
+func (w *Worldline) NewOrder(orderID int64, amount int64, currency Currency) OrderCreate {
 	// orders are prefixed with "O".
 	id := fmt.Sprintf("O%d", orderID)
 	return OrderCreate{
 		OrderID:     id,
 		Currency:    currency,
-		Amount:      amountInCents,
-		AcceptURL:   w.appURL + "/games/orders/accept",
-		CancelURL:   w.appURL + "/games/orders",
-		CallbackURL: w.appURL + "/games/orders/callback",
+		Amount:      amount,
+		AcceptURL:   w.appURL + "/lessons/orders/accept",
+		CancelURL:   w.appURL + "/lessons/orders/cancel",
+		CallbackURL: w.appURL + "/lessons/orders/callback",
 	}
 }
 
@@ -180,6 +179,64 @@ func (w *Worldline) CreateOrder(o OrderCreate) (*OrderResponse, error) {
 	return &OrderResponse{s.URL}, nil
 }
 
+type credit struct {
+	Amount int64 `json:"amount"`
+}
+
+type creditResponse struct {
+	Meta struct {
+		Result  bool `json:"result"`
+		Message struct {
+			EndUser  string `json:"enduser"`
+			Merchant string `json:"merchant"`
+		} `json:"message"`
+	} `json:"meta"`
+}
+
+// Refund amount (in ören) of the captured transaction txnID.
+func (w *Worldline) Refund(txnID string, amount int64) error {
+	var buff bytes.Buffer
+	if err := json.NewEncoder(&buff).Encode(credit{amount}); err != nil {
+		return err
+	}
+
+	endpoint := w.transactionURL + "/transactions/" + txnID + "/credit"
+	req, err := http.NewRequest(http.MethodPost, endpoint, &buff)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(w.username, w.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var unexpectedResponse bytes.Buffer
+
+		_, err := io.Copy(&unexpectedResponse, res.Body)
+		if err != nil {
+			return err
+		}
+
+		return errors.New(unexpectedResponse.String())
+	}
+
+	var c creditResponse
+	if err := json.NewDecoder(res.Body).Decode(&c); err != nil {
+		return err
+	}
+
+	if !c.Meta.Result {
+		return errors.New(c.Meta.Message.Merchant)
+	}
+
+	return nil
+}
+
 // Validate query by concatenating all params (in order, except hash param)
 // with md5key and compare with hash param.
 // md5(values + md5key) == hash
@@ -209,15 +266,30 @@ func md5Hash(b []byte) string {
 	return hex.EncodeToString(hash[:])
 }
 
-func New(appURL, mechant, username, password, md5key string) *Worldline {
-	apiURL := "https://api.v1.checkout.bambora.com/sessions"
+// Default worldline/bambora API URLs.
+const (
+	DefaultAPIURL         = "https://api.v1.checkout.bambora.com/sessions"
+	DefaultTransactionURL = "https://transaction-v1.api-eu.bambora.com"
+)
+
+// New worldline client. apiURL and transactionURL default to DefaultAPIURL
+// and DefaultTransactionURL when empty, point them at a FakeServer to run
+// payments offline.
+func New(apiURL, transactionURL, appURL, mechant, username, password, md5key string) *Worldline {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	if transactionURL == "" {
+		transactionURL = DefaultTransactionURL
+	}
 
 	return &Worldline{
-		apiURL:   apiURL,
-		appURL:   appURL,
-		username: username + "@" + mechant,
-		password: password,
-		md5Key:   md5key,
+		apiURL:         apiURL,
+		transactionURL: transactionURL,
+		appURL:         appURL,
+		username:       username + "@" + mechant,
+		password:       password,
+		md5Key:         md5key,
 		client: &http.Client{
 			Timeout: time.Second * 60,
 		},
@@ -0,0 +1,175 @@
+package worldline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testMD5Key = "secret"
+
+// appServer records the raw query of the callbacks it receives.
+type appServer struct {
+	mu        sync.Mutex
+	callbacks []string
+}
+
+func (a *appServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	a.callbacks = append(a.callbacks, r.URL.RawQuery)
+	a.mu.Unlock()
+}
+
+// pay creates an order on the fake checkout, pays it and returns the
+// callback query and the accept redirect.
+func pay(t *testing.T, w *Worldline, app *appServer, o OrderCreate) (string, *neturl.URL) {
+	t.Helper()
+
+	res, err := w.CreateOrder(o)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	page, err := http.Get(res.URL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", res.URL, err)
+	}
+	page.Body.Close()
+	if page.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %s", res.URL, page.Status)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	accept, err := client.Post(res.URL+"/accept", "", nil)
+	if err != nil {
+		t.Fatalf("POST accept: %v", err)
+	}
+	accept.Body.Close()
+	if accept.StatusCode != http.StatusFound {
+		t.Fatalf("POST accept: %s", accept.Status)
+	}
+
+	location, err := accept.Location()
+	if err != nil {
+		t.Fatalf("accept redirect: %v", err)
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if len(app.callbacks) != 1 {
+		t.Fatalf("got %d callbacks, want 1", len(app.callbacks))
+	}
+	return app.callbacks[0], location
+}
+
+func TestFakeServerPayment(t *testing.T) {
+	app := &appServer{}
+	appSrv := httptest.NewServer(app)
+	defer appSrv.Close()
+
+	fake := httptest.NewServer(NewFakeServer(testMD5Key))
+	defer fake.Close()
+
+	w := New(fake.URL+"/sessions", fake.URL, appSrv.URL, "merchant", "user", "password", testMD5Key)
+
+	callback, accept := pay(t, w, app, w.NewOrder(42, 12345, SEK))
+
+	q, err := neturl.ParseQuery(callback)
+	if err != nil {
+		t.Fatalf("callback query: %v", err)
+	}
+	if got := q.Get("orderid"); got != "O42" {
+		t.Errorf("orderid = %q, want O42", got)
+	}
+	if got := q.Get("amount"); got != "12345" {
+		t.Errorf("amount = %q, want 12345", got)
+	}
+	if got := q.Get("currency"); got != "752" {
+		t.Errorf("currency = %q, want 752", got)
+	}
+
+	if !w.Validate(callback) {
+		t.Errorf("Validate rejected the callback %q", callback)
+	}
+	if accept.Path != "/lessons/orders/accept" {
+		t.Errorf("accept path = %q, want /lessons/orders/accept", accept.Path)
+	}
+	if !w.Validate(accept.RawQuery) {
+		t.Errorf("Validate rejected the accept redirect %q", accept.RawQuery)
+	}
+
+	tampered := []string{
+		strings.Replace(callback, "amount=12345", "amount=1", 1),
+		strings.Replace(callback, "orderid=O42", "orderid=O43", 1),
+		callback[:strings.Index(callback, "hash=")+len("hash=")] + strings.Repeat("0", 32),
+	}
+	for _, raw := range tampered {
+		if w.Validate(raw) {
+			t.Errorf("Validate accepted the tampered callback %q", raw)
+		}
+	}
+
+	other := New(fake.URL+"/sessions", fake.URL, appSrv.URL, "merchant", "user", "password", "other")
+	if other.Validate(callback) {
+		t.Error("Validate accepted a callback signed with another md5 key")
+	}
+
+	txnID := q.Get("txnid")
+	if err := w.Refund(txnID, 10000); err != nil {
+		t.Errorf("Refund: %v", err)
+	}
+	if err := w.Refund(txnID, 10000); err == nil {
+		t.Error("Refund credited more than was paid")
+	}
+}
+
+func TestFakeServerCancel(t *testing.T) {
+	app := &appServer{}
+	appSrv := httptest.NewServer(app)
+	defer appSrv.Close()
+
+	fake := httptest.NewServer(NewFakeServer(testMD5Key))
+	defer fake.Close()
+
+	w := New(fake.URL+"/sessions", fake.URL, appSrv.URL, "merchant", "user", "password", testMD5Key)
+
+	res, err := w.CreateOrder(w.NewSubscription(7, 9900, SEK))
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	cancel, err := client.Post(res.URL+"/cancel", "", nil)
+	if err != nil {
+		t.Fatalf("POST cancel: %v", err)
+	}
+	cancel.Body.Close()
+
+	if got := cancel.Header.Get("Location"); got != appSrv.URL+"/subscriptions/cancel" {
+		t.Errorf("cancel redirect = %q, want %s/subscriptions/cancel", got, appSrv.URL)
+	}
+	if len(app.callbacks) != 0 {
+		t.Errorf("got %d callbacks for a cancelled payment, want 0", len(app.callbacks))
+	}
+
+	// the session is gone after cancel.
+	page, err := http.Get(res.URL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", res.URL, err)
+	}
+	page.Body.Close()
+	if page.StatusCode != http.StatusNotFound {
+		t.Errorf("GET cancelled session: %s, want 404", page.Status)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 )
 
 type Service struct {
@@ -29,18 +30,17 @@ var DefaultParams = map[string]string{
 	// "company_address":  "company_address_Value",
 }
 
-func (s *Service) SendActivationEmail(name, toEmail, tokenID, tokenValue string) {
+// Attachment to an email.
+type Attachment struct {
+	Name        string `json:"Name"`
+	Content     []byte `json:"Content"` // base64 encoded when marshalled
+	ContentType string `json:"ContentType"`
+}
 
-	log.Println("activation code:", toEmail, tokenValue)
+// sendWithTemplate sends the postmark template alias to toEmail.
+func (s *Service) sendWithTemplate(toEmail, alias string, templateModel map[string]any, attachments ...Attachment) error {
 	url := "https://api.postmarkapp.com/email/withTemplate"
 
-	// Request payload
-	templateModel := map[string]any{
-		"activationID":   tokenID,
-		"activationCode": tokenValue,
-		"name":           name,
-	}
-
 	for k, v := range DefaultParams {
 		templateModel[k] = v
 	}
@@ -48,18 +48,21 @@ func (s *Service) SendActivationEmail(name, toEmail, tokenID, tokenValue string)
 	payload := map[string]any{
 		"From":          "no-reply@upforschool.se",
 		"To":            toEmail,
-		"TemplateAlias": "account-activation",
+		"TemplateAlias": alias,
 		"TemplateModel": templateModel,
 	}
+	if len(attachments) > 0 {
+		payload["Attachments"] = attachments
+	}
 
 	body, err := json.Marshal(payload)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	req.Header.Set("Accept", "application/json")
@@ -69,9 +72,135 @@ func (s *Service) SendActivationEmail(name, toEmail, tokenID, tokenValue string)
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	fmt.Println("Status:", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("postmark: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Service) SendActivationEmail(name, toEmail, tokenID, tokenValue string) {
+
+	log.Println("activation code:", toEmail, tokenValue)
+
+	// Request payload
+	templateModel := map[string]any{
+		"activationID":   tokenID,
+		"activationCode": tokenValue,
+		"name":           name,
+	}
+
+	if err := s.sendWithTemplate(toEmail, "account-activation", templateModel); err != nil {
+		log.Printf("postmark: unable to send activation email: %v", err)
+	}
+}
+
+// SendSubscriptionReminder before the subscription ends at endsAt.
+func (s *Service) SendSubscriptionReminder(name, toEmail, planName string, endsAt time.Time) {
+	templateModel := map[string]any{
+		"name":       name,
+		"planName":   planName,
+		"endsAt":     endsAt.Format("2006-01-02"),
+		"renewalURL": "https://" + DefaultParams["product_url"] + "/subscriptions",
+	}
+
+	if err := s.sendWithTemplate(toEmail, "subscription-reminder", templateModel); err != nil {
+		log.Printf("postmark: unable to send subscription reminder: %v", err)
+	}
+}
+
+// SendRefundNotice when the payment for lesson title has been refunded.
+func (s *Service) SendRefundNotice(name, toEmail, title, amount string) {
+	templateModel := map[string]any{
+		"name":   name,
+		"title":  title,
+		"amount": amount,
+	}
+
+	if err := s.sendWithTemplate(toEmail, "lesson-refund", templateModel); err != nil {
+		log.Printf("postmark: unable to send refund notice: %v", err)
+	}
+}
+
+// SendReceipt for a completed payment with the PDF receipt attached.
+func (s *Service) SendReceipt(name, toEmail, number string, receipt []byte) {
+	templateModel := map[string]any{
+		"name":          name,
+		"receiptNumber": number,
+		"receiptsURL":   "https://" + DefaultParams["product_url"] + "/profile",
+	}
+
+	attachment := Attachment{
+		Name:        "kvitto-" + number + ".pdf",
+		Content:     receipt,
+		ContentType: "application/pdf",
+	}
+
+	if err := s.sendWithTemplate(toEmail, "payment-receipt", templateModel, attachment); err != nil {
+		log.Printf("postmark: unable to send receipt: %v", err)
+	}
+}
+
+// SendLessonRescheduled tells a tutor that the student moved lesson title to
+// startAt.
+func (s *Service) SendLessonRescheduled(name, toEmail, title, startAt string, duration int) {
+	templateModel := map[string]any{
+		"name":     name,
+		"title":    title,
+		"startAt":  startAt,
+		"duration": duration,
+		"homeURL":  "https://" + DefaultParams["product_url"] + "/home",
+	}
+
+	if err := s.sendWithTemplate(toEmail, "lesson-rescheduled", templateModel); err != nil {
+		log.Printf("postmark: unable to send lesson rescheduled: %v", err)
+	}
+}
+
+// SendLessonDeclined tells the student that every tutor they asked declined
+// lesson title.
+func (s *Service) SendLessonDeclined(name, toEmail, title string) {
+	templateModel := map[string]any{
+		"name":    name,
+		"title":   title,
+		"homeURL": "https://" + DefaultParams["product_url"] + "/home",
+	}
+
+	if err := s.sendWithTemplate(toEmail, "lesson-declined", templateModel); err != nil {
+		log.Printf("postmark: unable to send lesson declined: %v", err)
+	}
+}
+
+// SendLessonExpired tells the student that no tutor answered lesson title in
+// time and suggests other tutors to ask.
+func (s *Service) SendLessonExpired(name, toEmail, title string, tutors []string) {
+	templateModel := map[string]any{
+		"name":    name,
+		"title":   title,
+		"tutors":  tutors,
+		"homeURL": "https://" + DefaultParams["product_url"] + "/home",
+	}
+
+	if err := s.sendWithTemplate(toEmail, "lesson-expired", templateModel); err != nil {
+		log.Printf("postmark: unable to send lesson expired: %v", err)
+	}
+}
+
+// SendNewMessage tells name that from wrote to them about lesson title, with
+// a link to the conversation at path.
+func (s *Service) SendNewMessage(name, toEmail, from, title, path string) {
+	templateModel := map[string]any{
+		"name":       name,
+		"from":       from,
+		"title":      title,
+		"messageURL": "https://" + DefaultParams["product_url"] + path,
+	}
+
+	if err := s.sendWithTemplate(toEmail, "new-message", templateModel); err != nil {
+		log.Printf("postmark: unable to send new message: %v", err)
+	}
 }
@@ -30,6 +30,7 @@ CREATE TABLE users (
     ssn VARCHAR(12),
     sms_opt_in BOOLEAN NOT NULL DEFAULT FALSE,
     active_role TEXT NOT NULL DEFAULT 'STUDENT',
+    calendar_token TEXT UNIQUE, -- secret in the user's calendar feed URL
 
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
@@ -45,11 +46,13 @@ CREATE TABLE tutors (
     location_id INT REFERENCES locations(id),
     online_lessons BOOLEAN NOT NULL DEFAULT FALSE,
     description TEXT,
+    search_document TSVECTOR, -- alias, subjects, levels, locations and bio for the tutor search
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
-
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tutors_alias ON tutors(lower(alias));
+CREATE INDEX IF NOT EXISTS idx_tutors_search_document ON tutors USING GIN (search_document);
 
 CREATE TABLE tutor_subjects (
     tutor_id	UUID REFERENCES tutors(id),
@@ -69,6 +72,34 @@ CREATE TABLE tutor_locations (
     PRIMARY KEY (tutor_id, location_id)
 );
 
+-- weekly recurring times a tutor is free, local time in Europe/Stockholm.
+-- weekday 0 is sunday.
+CREATE TABLE tutor_availability (
+    id SERIAL PRIMARY KEY,
+    tutor_id UUID NOT NULL REFERENCES tutors(id),
+    weekday INT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL CHECK (end_time > start_time),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tutor_availability_tutor ON tutor_availability(tutor_id);
+
+-- one-off changes to the weekly availability, blocking time or adding free
+-- time. Without start and end time the whole day is covered.
+CREATE TABLE tutor_availability_exceptions (
+    id SERIAL PRIMARY KEY,
+    tutor_id UUID NOT NULL REFERENCES tutors(id),
+    date DATE NOT NULL,
+    start_time TIME,
+    end_time TIME,
+    available BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((start_time IS NULL AND end_time IS NULL) OR end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tutor_availability_exceptions_tutor ON tutor_availability_exceptions(tutor_id, date);
+
 CREATE TABLE logins (
     id	UUID PRIMARY KEY,
     user_id	UUID REFERENCES users(id),
@@ -103,6 +134,20 @@ CREATE TABLE levels (
 );
 
 
+-- a recurring lesson, one lesson is added per occurrence. The tutor accepts
+-- the series once.
+CREATE TABLE lesson_series (
+    id UUID PRIMARY KEY,
+    student_id UUID NOT NULL REFERENCES users(id),
+    tutor_id UUID REFERENCES tutors(id),
+    interval_weeks INT NOT NULL CHECK (interval_weeks IN (1, 2)),
+    count INT,
+    until DATE,
+    cancelled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 CREATE TABLE lessons (
     id UUID PRIMARY KEY,
     student_id UUID REFERENCES users(id),
@@ -113,45 +158,108 @@ CREATE TABLE lessons (
     title TEXT NOT NULL,
     description TEXT,
     start_at TIMESTAMPTZ NOT NULL,
+    duration INT NOT NULL DEFAULT 60, -- minutes
     tutor_id UUID REFERENCES tutors(id),
+    series_id UUID REFERENCES lesson_series(id),
+    is_open BOOLEAN NOT NULL DEFAULT FALSE, -- on the board for every matching tutor to apply
+    published_at TIMESTAMPTZ, -- an open lesson is on the board once paid for
+    sequence INT NOT NULL DEFAULT 0, -- increased when the time changes or the lesson is cancelled, for calendars
+    status TEXT NOT NULL DEFAULT 'REQUESTED', -- REQUESTED, ACCEPTED, SCHEDULED, COMPLETED, CANCELLED_BY_STUDENT, CANCELLED_BY_TUTOR or NO_SHOW
+    completed_at TIMESTAMPTZ, -- set when the lesson becomes COMPLETED
     deleted_at TIMESTAMPTZ,
+    archived_at TIMESTAMPTZ, -- over for a while, hidden from the lesson lists
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- the times and places a student proposes for a lesson, the tutor accepting
+-- picks one and the others are released.
+CREATE TABLE lesson_slots (
+    id SERIAL PRIMARY KEY,
+    lesson_id UUID NOT NULL REFERENCES lessons(id),
+    start_at TIMESTAMPTZ NOT NULL,
+    duration INT NOT NULL, -- minutes
+    location_id INT REFERENCES locations(id),
+    online_lesson BOOLEAN NOT NULL,
+    released_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_lesson_slots_lesson ON lesson_slots(lesson_id);
+
 CREATE TABLE lesson_requests (
     id SERIAL PRIMARY KEY,
     lesson_id UUID REFERENCES lessons(id),
     tutor_id UUID REFERENCES tutors(id),
+    slot_id INT REFERENCES lesson_slots(id),
     status TEXT NOT NULL DEFAULT 'PENDING',
+    message TEXT, -- from the tutor applying to an open lesson
     accepted_at TIMESTAMPTZ,
+    decline_reason TEXT, -- BUSY, SUBJECT, LOCATION or OTHER
+    decline_message TEXT,
+    declined_at TIMESTAMPTZ,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS idx_lesson_requests_lesson_tutor ON lesson_requests(lesson_id, tutor_id);
 
+-- every status a lesson has moved through, by the user making the change or
+-- NULL for the system.
+CREATE TABLE lesson_status_history (
+    id SERIAL PRIMARY KEY,
+    lesson_id UUID NOT NULL REFERENCES lessons(id),
+    from_status TEXT, -- NULL when the lesson is added
+    to_status TEXT NOT NULL,
+    user_id UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_lesson_status_history_lesson ON lesson_status_history(lesson_id);
+
 CREATE TABLE ratings (
     id SERIAL PRIMARY KEY,
     lesson_id UUID REFERENCES lessons(id),
     tutor_id UUID REFERENCES tutors(id),
-    grade INT NOT NULL DEFAULT 0,
+    grade INT NOT NULL CHECK (grade BETWEEN 1 AND 5),
     feedback TEXT NOT NULL DEFAULT '',
+    reply TEXT,
+    replied_at TIMESTAMPTZ,
+    hidden_at TIMESTAMPTZ,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (lesson_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ratings_tutor ON ratings(tutor_id);
+
+-- lesson_messages between the lesson's student and one of its tutors, a
+-- thread per lesson and tutor.
+CREATE TABLE lesson_messages (
+    id SERIAL PRIMARY KEY,
+    lesson_id UUID NOT NULL REFERENCES lessons(id),
+    tutor_id UUID NOT NULL REFERENCES tutors(id),
+    sender_id UUID NOT NULL REFERENCES users(id),
+    recipient_id UUID NOT NULL REFERENCES users(id),
+    body TEXT NOT NULL,
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX IF NOT EXISTS idx_lesson_messages_thread ON lesson_messages(lesson_id, tutor_id);
+CREATE INDEX IF NOT EXISTS idx_lesson_messages_unread ON lesson_messages(recipient_id) WHERE read_at IS NULL;
+
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
     lesson_id UUID REFERENCES lessons(id),
     discount_id INT REFERENCES discounts(id),
     quantity INT NOT NULL,
-    amount NUMERIC NOT NULL,
-    tax_amount NUMERIC NOT NULL,
-    discount_amount NUMERIC NOT NULL,
+    amount BIGINT NOT NULL,
+    tax_amount BIGINT NOT NULL,
+    discount_amount BIGINT NOT NULL,
     product_name TEXT NOT NULL,
-    product_cost NUMERIC NOT NULL,
-    product_tax NUMERIC NOT NULL,
+    product_cost BIGINT NOT NULL,
+    product_tax INT NOT NULL,
     currency TEXT NOT NULL,
     reference_user TEXT NOT NULL,
     reference_number TEXT NOT NULL,
@@ -182,15 +290,17 @@ CREATE TABLE subscription_payments (
 CREATE TABLE subscriptions (
     id SERIAL PRIMARY KEY,
     plan_id INT REFERENCES plans(id),
-    user_id INT REFERENCES users(id),
+    user_id UUID REFERENCES users(id),
     discount_id INT REFERENCES discounts(id),
     reference TEXT NOT NULL,
-    amount NUMERIC NOT NULL,
-    tax_amount NUMERIC NOT NULL,
-    discount_amount NUMERIC NOT NULL,
+    amount BIGINT NOT NULL,
+    tax_amount BIGINT NOT NULL,
+    discount_amount BIGINT NOT NULL,
     activated_at TIMESTAMPTZ,
     starts_at TIMESTAMPTZ,
     ends_at TIMESTAMPTZ,
+    reminded_at TIMESTAMPTZ,
+    status TEXT NOT NULL DEFAULT 'CREATED',
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -201,18 +311,56 @@ CREATE TABLE plans (
     role TEXT,
     period INT NOT NULL,
     interval INT NOT NULL,
-    price NUMERIC NOT NULL,
-    tax NUMERIC NOT NULL,
+    price BIGINT NOT NULL,
+    tax INT NOT NULL,
     currency TEXT NOT NULL,
     active BOOLEAN NOT NULL,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_ends ON subscriptions(user_id, ends_at);
+
+CREATE TABLE payment_events (
+    id SERIAL PRIMARY KEY,
+    txn_id TEXT NOT NULL UNIQUE,
+    order_id INT REFERENCES orders(id),
+    subscription_id INT REFERENCES subscriptions(id),
+    params TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (name, role, period, interval, price, tax, currency, active) values ('1 månad', 'STUDENT', 1, 1, 9900, 25, 'SEK', TRUE);
+INSERT INTO plans (name, role, period, interval, price, tax, currency, active) values ('3 månader', 'STUDENT', 3, 1, 24900, 25, 'SEK', TRUE);
+
+CREATE TABLE ledger_transactions (
+    id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    lesson_id UUID REFERENCES lessons(id),
+    tutor_id UUID REFERENCES tutors(id),
+    reference TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ledger_transactions_lesson ON ledger_transactions(lesson_id) WHERE kind = 'LESSON';
+
+-- debits are positive and credits negative, the entries of a transaction sum to zero.
+CREATE TABLE ledger_entries (
+    id SERIAL PRIMARY KEY,
+    transaction_id INT NOT NULL REFERENCES ledger_transactions(id),
+    account TEXT NOT NULL,
+    tutor_id UUID REFERENCES tutors(id),
+    amount BIGINT NOT NULL,
+    currency TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_tutor ON ledger_entries(tutor_id, account);
+
 CREATE TABLE discounts (
     id SERIAL PRIMARY KEY,
     code VARCHAR(50) NOT NULL,
-    amount NUMERIC NOT NULL DEFAULT 0,
+    amount BIGINT NOT NULL DEFAULT 0, -- percent, or minor units when not is_percent
     valid_to TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
@@ -313,4 +461,21 @@ INSERT INTO levels (id,name) values (2,'Mellanstadiet');
 INSERT INTO levels (id,name) values (3,'Högstadiet');
 INSERT INTO levels (id,name) values (4,'Gymnasiet');
 INSERT INTO levels (id,name) values (5,'Universitet/Högskola');
-INSERT INTO levels (id,name) values (6,'Vuxenutbildning');
\ No newline at end of file
+INSERT INTO levels (id,name) values (6,'Vuxenutbildning');
+
+-- backfill the search document of existing tutors, the same document as
+-- updateSearchDocument keeps up to date.
+UPDATE tutors SET search_document = d.document
+  FROM (SELECT t.id,
+               setweight(to_tsvector('swedish', t.alias), 'A') ||
+               setweight(to_tsvector('swedish', COALESCE(n.subjects, '')), 'A') ||
+               setweight(to_tsvector('swedish', COALESCE(n.levels, '')), 'B') ||
+               setweight(to_tsvector('swedish', n.locations), 'B') ||
+               setweight(to_tsvector('swedish', COALESCE(t.description, '')), 'C') AS document
+          FROM tutors AS t
+         CROSS JOIN LATERAL (
+               SELECT (SELECT string_agg(sb.name, ' ') FROM tutor_subjects AS ts JOIN subjects AS sb ON sb.id = ts.subject_id WHERE ts.tutor_id = t.id) AS subjects,
+                      (SELECT string_agg(lv.name, ' ') FROM tutor_levels AS tl JOIN levels AS lv ON lv.id = tl.level_id WHERE tl.tutor_id = t.id) AS levels,
+                      concat_ws(' ', CASE WHEN t.online_lessons THEN 'Online' END,
+                                (SELECT string_agg(lc.name, ' ') FROM tutor_locations AS tc JOIN locations AS lc ON lc.id = tc.location_id WHERE tc.tutor_id = t.id)) AS locations) AS n) AS d
+ WHERE tutors.id = d.id;